@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"iplists/cmd/internal/adb"
 	"iplists/cmd/internal/lib"
+	"iplists/internal/cidr"
+	"net/netip"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -18,8 +20,8 @@ var adbBuildCmd = &cobra.Command{
 	Short: "Build a list of IPs from AbuseIPDb cache",
 	Long: `This command builds a list of IPs from the AbuseIPDb cache.
 	
-It will read the local cache and output a list of IPs that are currently listed,
-active in the last N days (see flags).`,
+It will read the local cache and output an aggregated list of the IPs that are
+currently listed, active in the last N days (see flags).`,
 	Run: func(_ *cobra.Command, args []string) {
 		entries := adb.LoadADBCache(args[0], adbDays)
 		if len(entries) == 0 {
@@ -27,6 +29,12 @@ active in the last N days (see flags).`,
 			return
 		}
 
+		prefixes, count, err := aggregateADB(entries)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading AbuseIPDb cache %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+
 		f, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error opening list file %s: %v\n", args[1], err)
@@ -34,21 +42,19 @@ active in the last N days (see flags).`,
 		}
 		defer func() { _ = f.Close() }()
 
-		ips := 0
-		for _, entry := range entries {
-			if _, err := fmt.Fprintln(f, entry.IP); err != nil {
+		for _, p := range prefixes {
+			if _, err := fmt.Fprintln(f, cidr.Format(p)); err != nil {
 				fmt.Fprintf(os.Stderr, "Error writing to list file %s: %v\n", args[1], err)
 				os.Exit(1)
 			}
-			ips++
 		}
 
 		if adbDays <= 0 {
-			fmt.Printf("Wrote %s entries to %s\n", lib.NumberFormat(ips), args[1])
+			fmt.Printf("Wrote %s entries from %s ips to %s\n", lib.NumberFormat(len(prefixes)), lib.NumberFormat(count), args[1])
 			return
 		}
 
-		fmt.Printf("Wrote %s ips active in the last %d days to %s\n", lib.NumberFormat(ips), adbDays, args[1])
+		fmt.Printf("Wrote %s entries from %s ips active in the last %d days to %s\n", lib.NumberFormat(len(prefixes)), lib.NumberFormat(count), adbDays, args[1])
 	},
 }
 
@@ -56,3 +62,24 @@ func init() {
 	adbCmd.AddCommand(adbBuildCmd)
 	adbBuildCmd.Flags().IntVarP(&adbDays, "days", "d", 30, "Active in the last N days")
 }
+
+// aggregateADB streams the cached IPs through the aggregation engine,
+// returning the aggregated prefixes and the number of IPs read.
+func aggregateADB(entries []adb.Entry) ([]netip.Prefix, int, error) {
+	agg := cidr.NewAggregator(0)
+	defer func() { _ = agg.Close() }()
+
+	for _, entry := range entries {
+		p, err := cidr.Parse(entry.IP)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := agg.Add(p); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	prefixes, err := agg.Prefixes()
+
+	return prefixes, agg.Count, err
+}
@@ -2,125 +2,202 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"iplists/cmd/internal/lib"
-	"log"
-	"net"
+	"iplists/internal/cidr"
+	"net/netip"
 	"os"
 	"path"
-	"sort"
 	"strings"
 
-	"github.com/projectdiscovery/mapcidr"
 	"github.com/spf13/cobra"
 )
 
 var (
-	aggregateOverwrite bool
-	aggregateStatsOnly bool
+	aggregateOverwrite  bool
+	aggregateStatsOnly  bool
+	aggregateIPv6Single int
+	aggregateMaxEntries int
+	aggregateProtect    []string
+	aggregatePromoteV4  string
+	aggregatePromoteV6  string
+	aggregateExplain    string
+	aggregateOutput     string
+	aggregateV4Out      string
+	aggregateV6Out      string
 )
 
 // aggregateCmd represents the aggregate command
 var aggregateCmd = &cobra.Command{
-	Use:   "aggregate",
+	Use:   "aggregate <file|-> [<file>...]",
 	Short: "Aggregate IPs/CIDRs into minimum IPs & subnets",
-	Long:  `Aggregate IPs/CIDRs into minimum IPs & subnets.`,
-	Args:  cobra.ExactArgs(1),
-	Run: func(_ *cobra.Command, args []string) {
-		lines, err := lib.GetContents(path.Clean(args[0]))
-		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", args[0], err)
-			return
-		}
+	Long: `Aggregate IPs/CIDRs into minimum IPs & subnets.
 
-		var allCidrs []*net.IPNet
+Multiple input files are merged into a single result, use "-" to read from stdin.
+The result is written to stdout unless -w (single input file), -o, --v4-out or
+--v6-out are set. --v4-out and --v6-out write each family to a separate file,
+the other family to the main output, so -w & -o need one of them unset.
 
-		// test if we have a cidr
-		for _, cidr := range lines {
-			if !strings.Contains(cidr, "/") {
-				// if not a CIDR, try to parse as an IP
-				ip := net.ParseIP(cidr)
-				if ip == nil {
-					log.Fatalf("Invalid IP or CIDR: %s\n", cidr)
-				}
+Single IPv6 addresses are treated as /128 by default. Use --ipv6-single-prefix
+to widen them to the /64 or /56 customer allocation instead.
 
-				// if it's a valid IP, convert it to a /32 CIDR
-				if ip.To4() != nil {
-					cidr = fmt.Sprintf("%s/32", ip.String())
-				} else if ip.To16() != nil {
-					cidr = fmt.Sprintf("%s/64", ip.String())
-				} else {
-					log.Fatalf("Invalid IP or CIDR: %s\n", cidr)
-				}
-			}
+Use --max-entries to limit the size of the output for WAFs with a maximum IP set
+size. This is lossy: neighbouring entries are merged into supernets, choosing the
+merges which cover the fewest additional addresses. IPv4 & IPv6 are reduced
+separately, sharing the entries in proportion to their size. Supernets will
+never overlap ranges in the --protect list(s).
+
+Use --promote-v4 and --promote-v6 to block an entire network when enough of it
+is listed, in the format of <bits>:<count> or <bits>:<percent>%, eg: "24:8" or
+"24:10%". IPv6 counts are in /64 networks, or addresses for networks longer than
+/64, eg: "120:8". Promotion also honours --protect.
+
+Use --explain to write a report of which input entries were absorbed into each
+output entry, and whether by merging or by a covering prefix.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		if aggregateIPv6Single != 128 && aggregateIPv6Single != 64 && aggregateIPv6Single != 56 {
+			fmt.Fprintln(os.Stderr, "--ipv6-single-prefix must be one of 128, 64 or 56")
+			os.Exit(1)
+		}
 
-			_, pCidr, err := net.ParseCIDR(cidr)
+		promotions := []cidr.Promotion{}
+		for i, rule := range []string{aggregatePromoteV4, aggregatePromoteV6} {
+			if rule == "" {
+				continue
+			}
+			// the second rule is IPv6
+			promotion, err := cidr.ParsePromotion(rule, i == 1)
 			if err != nil {
-				log.Fatalf("%s\n", err)
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
 			}
+			promotions = append(promotions, promotion)
+		}
+
+		if aggregateOverwrite && (len(args) != 1 || args[0] == "-") {
+			fmt.Fprintln(os.Stderr, "-w can only be used with a single input file")
+			os.Exit(1)
+		}
+		if aggregateOverwrite && aggregateOutput != "" {
+			fmt.Fprintln(os.Stderr, "-w cannot be used with -o")
+			os.Exit(1)
+		}
+		// no family would be left for the main output, which would be emptied
+		if (aggregateOverwrite || aggregateOutput != "") && aggregateV4Out != "" && aggregateV6Out != "" {
+			fmt.Fprintln(os.Stderr, "-w and -o cannot be used with both --v4-out and --v6-out")
+			os.Exit(1)
+		}
 
-			allCidrs = append(allCidrs, pCidr)
+		names := make([]string, 0, len(args))
+		for _, file := range args {
+			names = append(names, inputName(file))
 		}
+		source := strings.Join(names, ", ")
 
-		cCidrsIPV4, cCidrsIPV6 := mapcidr.CoalesceCIDRs(allCidrs)
+		prefixes, inputs, count, err := aggregateFiles(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error aggregating: %v\n", err)
+			os.Exit(1)
+		}
 
-		outputIPv4 := make([]string, 0, len(cCidrsIPV4))
-		outputIPv6 := make([]string, 0, len(cCidrsIPV6))
+		if count == 0 {
+			fmt.Fprintf(os.Stderr, "No valid IPs found in %s\n", source)
+			os.Exit(1)
+		}
 
-		for _, cidr := range cCidrsIPV4 {
-			if strings.HasSuffix(cidr.String(), "/32") {
-				// if it's a /32 CIDR, print the IP only
-				outputIPv4 = append(outputIPv4, strings.TrimSuffix(cidr.String(), "/32"))
-			} else {
-				outputIPv4 = append(outputIPv4, cidr.String())
-			}
+		// the main output, any family with a separate output is excluded
+		output := aggregateOutput
+		if aggregateOverwrite {
+			output = args[0]
 		}
-		for _, cidr := range cCidrsIPV6 {
-			outputIPv6 = append(outputIPv6, cidr.String())
+		toStdout := !aggregateStatsOnly && output == "" && (aggregateV4Out == "" || aggregateV6Out == "")
+
+		protect, err := cidr.LoadFiles(aggregateProtect...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading protected list: %v\n", err)
+			os.Exit(1)
 		}
 
-		sort.Strings(outputIPv4)
-		sort.Strings(outputIPv6)
+		// keep stdout clean for the list itself
+		report := os.Stdout
+		if toStdout {
+			report = os.Stderr
+		}
 
-		if !aggregateOverwrite && !aggregateStatsOnly {
-			for _, cidr := range outputIPv4 {
-				fmt.Println(cidr)
+		for _, rule := range promotions {
+			var promoted int
+			prefixes, promoted = cidr.Promote(prefixes, rule, protect)
+			if promoted > 0 {
+				fmt.Fprintf(report, "Promoted %s dense networks to /%d\n", lib.NumberFormat(promoted), rule.Bits)
 			}
-			for _, cidr := range outputIPv6 {
-				fmt.Println(cidr)
+		}
+
+		if aggregateMaxEntries > 0 {
+			var cost cidr.Cost
+			prefixes, cost = cidr.Reduce(prefixes, aggregateMaxEntries, protect)
+			if len(prefixes) > aggregateMaxEntries {
+				fmt.Fprintf(report, "Unable to reduce below %s entries without overlapping protected ranges\n", lib.NumberFormat(len(prefixes)))
 			}
-			return
+			fmt.Fprintf(
+				report,
+				"Reduced to %s entries, over-blocking %s IPv4 addresses & %s IPv6 /64 networks\n",
+				lib.NumberFormat(len(prefixes)),
+				lib.NumberFormat(int(cost.IPv4)),
+				lib.NumberFormat(int(cost.IPv6)),
+			)
 		}
 
-		if !aggregateStatsOnly {
-			// write the updated entries to the cache file
-			f, err := os.Create(path.Clean(args[0]))
-			if err != nil {
-				fmt.Printf("Failed to create cache file: %s\n", err.Error())
+		if aggregateExplain != "" {
+			if err := writeExplanations(aggregateExplain, cidr.Explain(inputs, prefixes)); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing explanations to %s: %v\n", aggregateExplain, err)
 				os.Exit(1)
 			}
-			defer func() { _ = f.Close() }()
+		}
+
+		outputIPv4 := []string{}
+		outputIPv6 := []string{}
+
+		for _, p := range prefixes {
+			if p.Addr().Is4() {
+				outputIPv4 = append(outputIPv4, cidr.Format(p))
+			} else {
+				outputIPv6 = append(outputIPv6, cidr.Format(p))
+			}
+		}
 
-			for _, entry := range outputIPv4 {
-				if _, err := fmt.Fprintln(f, entry); err != nil {
-					fmt.Fprintf(os.Stderr, "Error writing to file %s: %v\n", args[1], err)
+		if !aggregateStatsOnly {
+			mainLines := []string{}
+			for _, family := range []struct {
+				file    string
+				entries []string
+			}{{aggregateV4Out, outputIPv4}, {aggregateV6Out, outputIPv6}} {
+				if family.file == "" {
+					mainLines = append(mainLines, family.entries...)
+					continue
+				}
+				if err := lib.WriteLines(path.Clean(family.file), family.entries); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing to file %s: %v\n", family.file, err)
 					os.Exit(1)
 				}
 			}
 
-			for _, entry := range outputIPv6 {
-				if _, err := fmt.Fprintln(f, entry); err != nil {
-					fmt.Fprintf(os.Stderr, "Error writing to file %s: %v\n", args[1], err)
-					os.Exit(1)
+			if toStdout {
+				for _, entry := range mainLines {
+					fmt.Println(entry)
 				}
+				return
 			}
-		}
 
-		if len(lines) == 0 {
-			fmt.Fprintf(os.Stderr, "No valid IPs found in file %s\n", args[1])
-			os.Exit(1)
+			if output != "" {
+				if err := lib.WriteLines(path.Clean(output), mainLines); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing to file %s: %v\n", output, err)
+					os.Exit(1)
+				}
+			}
 		}
 
-		if len(lines) == len(outputIPv4)+len(outputIPv6) {
+		if count == len(outputIPv4)+len(outputIPv6) {
 			fmt.Println("No aggregation needed, input and output are the same.")
 			return
 		}
@@ -128,8 +205,8 @@ var aggregateCmd = &cobra.Command{
 		fmt.Printf(
 			"Aggregated %s from %s IPs & CIDRs in %s\n",
 			lib.NumberFormat(len(outputIPv4)+len(outputIPv6)),
-			lib.NumberFormat(len(lines)),
-			args[0],
+			lib.NumberFormat(count),
+			source,
 		)
 	},
 }
@@ -138,5 +215,92 @@ func init() {
 	rootCmd.AddCommand(aggregateCmd)
 
 	aggregateCmd.Flags().BoolVarP(&aggregateOverwrite, "write", "w", false, "Overwrite file (default stdout)")
+	aggregateCmd.Flags().StringVarP(&aggregateOutput, "output", "o", "", "Write to file (default stdout)")
+	aggregateCmd.Flags().StringVar(&aggregateV4Out, "v4-out", "", "Write IPv4 entries to a separate file")
+	aggregateCmd.Flags().StringVar(&aggregateV6Out, "v6-out", "", "Write IPv6 entries to a separate file")
 	aggregateCmd.Flags().BoolVarP(&aggregateStatsOnly, "stats", "s", false, "Show stats only, do not write to file")
+	aggregateCmd.Flags().IntVar(&aggregateIPv6Single, "ipv6-single-prefix", 128, "Prefix length for single IPv6 addresses (128, 64 or 56)")
+	aggregateCmd.Flags().IntVar(&aggregateMaxEntries, "max-entries", 0, "Lossy reduction to a maximum number of entries")
+	aggregateCmd.Flags().StringSliceVar(&aggregateProtect, "protect", []string{}, "List file(s) which supernets may not overlap")
+	aggregateCmd.Flags().StringVar(&aggregatePromoteV4, "promote-v4", "", "Promote dense IPv4 networks, eg: 24:8 or 24:10%")
+	aggregateCmd.Flags().StringVar(&aggregatePromoteV6, "promote-v6", "", "Promote dense IPv6 networks, eg: 48:4 or 48:10%")
+	aggregateCmd.Flags().StringVar(&aggregateExplain, "explain", "", "Write an explanation of the aggregation to a file")
+}
+
+// aggregateFiles streams the IPs & CIDRs from the input files through the
+// aggregation engine, returning the aggregated prefixes, the inputs (only
+// when explaining) and the number of entries read.
+func aggregateFiles(files []string) ([]netip.Prefix, []cidr.Input, int, error) {
+	agg := cidr.NewAggregator(0)
+	defer func() { _ = agg.Close() }()
+
+	inputs := []cidr.Input{}
+
+	for _, file := range files {
+		r, err := readInput(file)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("%s: %w", inputName(file), err)
+		}
+
+		err = lib.EachLine(r, func(entry string) error {
+			p, err := cidr.Parse(entry)
+			if err != nil {
+				return err
+			}
+
+			if p.Addr().Is6() && p.IsSingleIP() {
+				p = netip.PrefixFrom(p.Addr(), aggregateIPv6Single).Masked()
+			}
+
+			if aggregateExplain != "" {
+				inputs = append(inputs, cidr.Input{Entry: entry, Prefix: p})
+			}
+
+			return agg.Add(p)
+		})
+		_ = r.Close()
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("%s: %w", inputName(file), err)
+		}
+	}
+
+	prefixes, err := agg.Prefixes()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return prefixes, inputs, agg.Count, nil
+}
+
+// writeExplanations writes the aggregation explanations to a file.
+func writeExplanations(file string, explanations []cidr.Explanation) error {
+	f, err := os.Create(path.Clean(file))
+	if err != nil {
+		return err
+	}
+
+	if err := cidr.WriteExplanations(f, explanations); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// readInput opens a file for reading, or stdin for "-".
+func readInput(file string) (io.ReadCloser, error) {
+	if file == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	return os.Open(path.Clean(file))
+}
+
+// inputName returns a display name for an input file.
+func inputName(file string) string {
+	if file == "-" {
+		return "stdin"
+	}
+
+	return file
 }
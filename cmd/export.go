@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"iplists/cmd/internal/export"
+	"iplists/cmd/internal/lib"
+	"iplists/internal/cidr"
+	"iplists/pkg/lists"
+	"net/netip"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat    string
+	exportOutput    string
+	exportName      string
+	exportNftFamily string
+	exportNftTable  string
+	exportChunkSize int
+	exportVariable  string
+	exportValues    []string
+	exportAction    string
+	exportScope     string
+	exportSetSize   int
+	exportTimeout   string
+	exportCommunity string
+	exportPrevious  []string
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export --format <format> <list|-> [<list>...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Export lists to firewall, web server & WAF formats",
+	Long: `Export one or more lists to the configuration format of a firewall, web server
+or WAF. Each list is aggregated and exported under its name (the file name
+without the extension), use --name to merge all lists into a single list.
+Use "-" to read a list from stdin.
+
+Use --value to set the value of the entries of all lists, or of a single list
+with <list>=<value>, eg: --value 1 --value googlebot=bot, for nginx geo blocks &
+HAProxy maps. Use --action to allow rather than deny in nginx & Apache rules,
+and Azure WAF custom rules.
+
+Cloud WAF formats are split into multiple sets or rules at the size limit of the
+service, or --set-size.
+
+Use --mikrotik-timeout to add MikroTik address-list entries which expire, and
+--bird-community to set the community of BIRD blackhole routes.
+
+Use --previous with the lists of the previous export to remove the entries no
+longer listed from Cisco object-groups, which are updated in place.
+
+Formats:
+` + exportFormats(),
+	Run: func(_ *cobra.Command, args []string) {
+		if _, err := export.Get(exportFormat); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if exportAction != "allow" && exportAction != "deny" {
+			fmt.Fprintln(os.Stderr, "--action must be one of allow or deny")
+			os.Exit(1)
+		}
+
+		exports, err := exportLists(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %v\n", err)
+			os.Exit(1)
+		}
+
+		previous, err := exportLists(exportPrevious)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading previous %v\n", err)
+			os.Exit(1)
+		}
+
+		opts := export.Options{
+			Family:    exportNftFamily,
+			Table:     exportNftTable,
+			ChunkSize: exportChunkSize,
+			Variable:  exportVariable,
+			Values:    map[string]string{},
+			Action:    exportAction,
+			Scope:     exportScope,
+			SetSize:   exportSetSize,
+			Timeout:   exportTimeout,
+			Community: exportCommunity,
+			Previous:  previous,
+		}
+		for _, value := range exportValues {
+			name, value, ok := strings.Cut(value, "=")
+			if !ok {
+				name, value = "", name
+			}
+			opts.Values[name] = value
+		}
+
+		var w io.Writer = os.Stdout
+		if exportOutput != "" {
+			f, err := os.Create(path.Clean(exportOutput))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing to file %s: %v\n", exportOutput, err)
+				os.Exit(1)
+			}
+			defer func() { _ = f.Close() }()
+			w = f
+		}
+
+		if err := export.Write(w, exportFormat, exports, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "", "Export format (required)")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write to file (default stdout)")
+	exportCmd.Flags().StringVar(&exportName, "name", "", "Merge all lists into a single list of this name")
+	exportCmd.Flags().StringVar(&exportNftFamily, "nft-family", export.DefaultOptions.Family, "nftables family of the sets")
+	exportCmd.Flags().StringVar(&exportNftTable, "nft-table", export.DefaultOptions.Table, "nftables table of the sets")
+	exportCmd.Flags().IntVar(&exportChunkSize, "chunk-size", export.DefaultOptions.ChunkSize, "Maximum number of elements per command")
+	exportCmd.Flags().StringVar(&exportVariable, "variable", export.DefaultOptions.Variable, "nginx geo variable")
+	exportCmd.Flags().StringArrayVar(&exportValues, "value", []string{}, "Value of the entries of all lists, or <list>=<value> (default 1)")
+	exportCmd.Flags().StringVar(&exportAction, "action", export.DefaultOptions.Action, "allow or deny, for nginx, Apache & Azure WAF rules")
+	exportCmd.Flags().StringVar(&exportScope, "aws-scope", export.DefaultOptions.Scope, "AWS WAFv2 scope of IPSets (REGIONAL or CLOUDFRONT)")
+	exportCmd.Flags().IntVar(&exportSetSize, "set-size", 0, "Maximum entries per set or rule (default the service limit)")
+	exportCmd.Flags().StringVar(&exportTimeout, "mikrotik-timeout", "", "Timeout of MikroTik address-list entries, eg: 1d (default none)")
+	exportCmd.Flags().StringVar(&exportCommunity, "bird-community", export.DefaultOptions.Community, "BGP community of BIRD blackhole routes, asn,value or asn,value,value")
+	exportCmd.Flags().StringArrayVar(&exportPrevious, "previous", []string{}, "Previously exported list, to remove entries no longer listed from object-groups")
+	_ = exportCmd.MarkFlagRequired("format")
+}
+
+// exportLists reads and aggregates the lists to export, merging them into a
+// single list if --name is set.
+func exportLists(files []string) ([]export.List, error) {
+	exports := []export.List{}
+	for _, file := range files {
+		r, err := readInput(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", inputName(file), err)
+		}
+
+		prefixes := []netip.Prefix{}
+		err = lib.EachLine(r, func(entry string) error {
+			p, err := cidr.Parse(entry)
+			if err != nil {
+				return err
+			}
+			prefixes = append(prefixes, p)
+			return nil
+		})
+		_ = r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", inputName(file), err)
+		}
+
+		exports = append(exports, export.List{Name: lists.Name(inputName(file)), Prefixes: prefixes})
+	}
+
+	if exportName != "" {
+		merged := export.List{Name: exportName}
+		for _, l := range exports {
+			merged.Prefixes = append(merged.Prefixes, l.Prefixes...)
+		}
+		exports = []export.List{merged}
+	}
+
+	for i := range exports {
+		exports[i].Prefixes = cidr.Aggregate(exports[i].Prefixes)
+	}
+
+	return exports, nil
+}
+
+// exportFormats returns the help text of the export formats.
+func exportFormats() string {
+	width := 0
+	for _, name := range export.Names() {
+		width = max(width, len(name))
+	}
+
+	var b strings.Builder
+	for _, name := range export.Names() {
+		format, _ := export.Get(name)
+		fmt.Fprintf(&b, "  %-*s %s\n", width, name, format.Description)
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"iplists/cmd/internal/accesslog"
+	"iplists/cmd/internal/lib"
+	"iplists/pkg/bots"
+	"iplists/pkg/lists"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	fakeBotsListsDir string
+	fakeBotsFormat   string
+	fakeBotsLogType  string
+	fakeBotsIPField  string
+	fakeBotsUAField  string
+	fakeBotsMin      int
+)
+
+// fakeBot is an IP spoofing the User-Agent of one or more crawlers
+type fakeBot struct {
+	IP        netip.Addr `json:"ip"`
+	Requests  int        `json:"requests"`
+	Bots      []string   `json:"bots"`
+	UserAgent string     `json:"user_agent"`
+}
+
+// fakeBotsCmd represents the fake-bots command
+var fakeBotsCmd = &cobra.Command{
+	Use:   "fake-bots <logfile|-> [<logfile>...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Report IPs spoofing crawler User-Agents in access logs",
+	Long: `Scan access logs for requests whose User-Agent claims to be a crawler with a
+published list, eg: Googlebot, Bingbot, Applebot or GPTBot, but whose IP is not
+in that list, and report the spoofing IPs ranked by their number of requests.
+
+The report is CSV (ip, requests, bots, user_agent), JSON, or txt for the IPs
+only, which can be fed back into a blocklist. The log formats are the same as
+for scan (see --log-format, --ip-field & --ua-field).`,
+	Run: func(_ *cobra.Command, args []string) {
+		if fakeBotsFormat != "csv" && fakeBotsFormat != "json" && fakeBotsFormat != "txt" {
+			fmt.Fprintln(os.Stderr, "--format must be one of csv, json or txt")
+			os.Exit(1)
+		}
+
+		parser, err := accesslog.NewParser(accesslog.Format(fakeBotsLogType), fakeBotsIPField, fakeBotsUAField)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		set, err := lists.LoadDir(fakeBotsListsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading lists from %s: %v\n", fakeBotsListsDir, err)
+			os.Exit(1)
+		}
+		verifier := bots.NewVerifier(set)
+
+		// verdicts are cached by IP and claimed crawler, rather than by the
+		// User-Agent which varies by version, so the cache grows no faster than
+		// the report of spoofing IPs
+		type claim struct {
+			ip  netip.Addr
+			bot string
+		}
+		verdicts := map[claim]bots.Result{}
+		spoofed := map[netip.Addr]*fakeBot{}
+		total, claimed := 0, 0
+
+		for _, file := range args {
+			_, err := scanLog(parser, file, func(e accesslog.Entry) {
+				total++
+				bot, ok := bots.Identify(e.UserAgent)
+				if !ok {
+					return
+				}
+
+				key := claim{e.IP, bot.Name}
+				result, ok := verdicts[key]
+				if !ok {
+					result = verifier.Verify(e.UserAgent, e.IP)
+					verdicts[key] = result
+				}
+				if result.Verdict == bots.Unknown {
+					return
+				}
+
+				claimed++
+				if result.Verdict != bots.Spoofed {
+					return
+				}
+
+				fake := spoofed[e.IP]
+				if fake == nil {
+					fake = &fakeBot{IP: e.IP, Bots: []string{}, UserAgent: e.UserAgent}
+					spoofed[e.IP] = fake
+				}
+				fake.Requests++
+				if !slices.Contains(fake.Bots, result.Bot) {
+					fake.Bots = append(fake.Bots, result.Bot)
+				}
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", inputName(file), err)
+				os.Exit(1)
+			}
+		}
+
+		fakes := []fakeBot{}
+		requests := 0
+		for _, fake := range spoofed {
+			requests += fake.Requests
+			if fake.Requests >= fakeBotsMin {
+				fakes = append(fakes, *fake)
+			}
+		}
+		slices.SortFunc(fakes, func(a, b fakeBot) int {
+			if a.Requests != b.Requests {
+				return b.Requests - a.Requests
+			}
+			return a.IP.Compare(b.IP)
+		})
+
+		if err := writeFakeBots(fakes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(
+			os.Stderr,
+			"%s of %s crawler requests were spoofed, from %s IPs (%s requests scanned)\n",
+			lib.NumberFormat(requests),
+			lib.NumberFormat(claimed),
+			lib.NumberFormat(len(spoofed)),
+			lib.NumberFormat(total),
+		)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fakeBotsCmd)
+
+	fakeBotsCmd.Flags().StringVar(&fakeBotsListsDir, "lists-dir", "lists", "Directory of lists")
+	fakeBotsCmd.Flags().StringVarP(&fakeBotsFormat, "format", "f", "csv", "Report format (csv, json or txt)")
+	fakeBotsCmd.Flags().StringVar(&fakeBotsLogType, "log-format", "auto", "Log format (auto, combined, json or plain)")
+	fakeBotsCmd.Flags().StringVar(&fakeBotsIPField, "ip-field", "remote_addr", "Client IP field of JSON logs")
+	fakeBotsCmd.Flags().StringVar(&fakeBotsUAField, "ua-field", "http_user_agent", "User-Agent field of JSON logs")
+	fakeBotsCmd.Flags().IntVar(&fakeBotsMin, "min-requests", 1, "Minimum number of spoofed requests to report an IP")
+}
+
+// writeFakeBots writes the spoofing IPs to stdout in the selected format.
+func writeFakeBots(fakes []fakeBot) error {
+	switch fakeBotsFormat {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(fakes)
+	case "txt":
+		for _, fake := range fakes {
+			fmt.Println(fake.IP)
+		}
+		return nil
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write([]string{"ip", "requests", "bots", "user_agent"})
+	for _, fake := range fakes {
+		_ = w.Write([]string{
+			fake.IP.String(),
+			strconv.Itoa(fake.Requests),
+			strings.Join(fake.Bots, ";"),
+			fake.UserAgent,
+		})
+	}
+	w.Flush()
+
+	return w.Error()
+}
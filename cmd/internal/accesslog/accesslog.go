@@ -0,0 +1,203 @@
+// Package accesslog parses the client IP and User-Agent from access logs.
+package accesslog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iplists/pkg/realip"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Entry is a parsed log line.
+type Entry struct {
+	IP        netip.Addr
+	UserAgent string
+}
+
+// Format is a log format.
+type Format string
+
+const (
+	// Auto detects the format of each line.
+	Auto Format = "auto"
+	// Combined is the nginx/Apache combined (or common) log format.
+	Combined Format = "combined"
+	// JSON is JSON lines, with the IP & User-Agent in configurable fields.
+	JSON Format = "json"
+	// Plain is any text, the first IP of each line is the client IP.
+	Plain Format = "plain"
+)
+
+// combined matches the common log format, with the referer & User-Agent of the
+// combined log format being optional.
+var combined = regexp.MustCompile(`^(\S+) \S+ \S+ \[[^\]]*\] "(?:[^"\\]|\\.)*" \d{3} \S+(?: "(?:[^"\\]|\\.)*" "((?:[^"\\]|\\.)*)")?`)
+
+// Parser parses log lines of a format.
+type Parser struct {
+	format  Format
+	ipField []string
+	uaField []string
+}
+
+// NewParser returns a Parser for the format. The IP & User-Agent fields are
+// only used for JSON, and may be nested with dots, eg: "client.ip".
+func NewParser(format Format, ipField, uaField string) (*Parser, error) {
+	switch format {
+	case Auto, Combined, JSON, Plain:
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", format)
+	}
+
+	return &Parser{
+		format:  format,
+		ipField: strings.Split(ipField, "."),
+		uaField: strings.Split(uaField, "."),
+	}, nil
+}
+
+// Parse parses a log line, returning false if no client IP was found.
+func (p *Parser) Parse(line string) (Entry, bool) {
+	switch p.format {
+	case Combined:
+		return parseCombined(line)
+	case JSON:
+		return p.parseJSON(line)
+	case Plain:
+		return parsePlain(line)
+	}
+
+	if strings.HasPrefix(line, "{") {
+		return p.parseJSON(line)
+	}
+	if e, ok := parseCombined(line); ok {
+		return e, true
+	}
+
+	return parsePlain(line)
+}
+
+func parseCombined(line string) (Entry, bool) {
+	m := combined.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, false
+	}
+
+	addr, ok := parseAddr(m[1])
+	if !ok {
+		return Entry{}, false
+	}
+
+	return Entry{IP: addr, UserAgent: strings.ReplaceAll(m[2], `\"`, `"`)}, true
+}
+
+func (p *Parser) parseJSON(line string) (Entry, bool) {
+	var v map[string]any
+	if err := json.Unmarshal([]byte(line), &v); err != nil {
+		return Entry{}, false
+	}
+
+	ip, _ := field(v, p.ipField).(string)
+	addr, ok := parseAddr(ip)
+	if !ok {
+		return Entry{}, false
+	}
+	ua, _ := field(v, p.uaField).(string)
+
+	return Entry{IP: addr, UserAgent: ua}, true
+}
+
+func parsePlain(line string) (Entry, bool) {
+	for f := range strings.FieldsSeq(line) {
+		if addr, ok := parseAddr(strings.Trim(f, `"'(),;`)); ok {
+			return Entry{IP: addr}, true
+		}
+	}
+
+	return Entry{}, false
+}
+
+// field returns a nested field of a JSON object.
+func field(v map[string]any, path []string) any {
+	var value any = v
+	for _, key := range path {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+
+	return value
+}
+
+// parseAddr parses the first IP of a value, which may be forwarded, eg:
+// "1.2.3.4, 10.0.0.1".
+func parseAddr(s string) (netip.Addr, bool) {
+	s, _, _ = strings.Cut(s, ",")
+	addr, err := realip.ParseHost(strings.TrimSpace(s))
+
+	return addr, err == nil
+}
+
+// Open opens a log file, or stdin for "-", decompressing ".gz" files.
+func Open(file string) (io.ReadCloser, error) {
+	if file == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(file, ".gz") {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return readCloser{gz, f}, nil
+}
+
+type readCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r readCloser) Close() error {
+	_ = r.Reader.Close()
+	return r.file.Close()
+}
+
+// Scan calls fn for every parsed entry of a log, returning the number of lines
+// which could not be parsed.
+func (p *Parser) Scan(r io.Reader, fn func(Entry)) (int, error) {
+	skipped := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		e, ok := p.Parse(line)
+		if !ok {
+			skipped++
+			continue
+		}
+		fn(e)
+	}
+
+	return skipped, scanner.Err()
+}
@@ -0,0 +1,145 @@
+package accesslog
+
+import (
+	"compress/gzip"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const (
+		combinedLine = `1.1.1.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://example.com/" "Mozilla/5.0 (compatible; Googlebot/2.1)"`
+		commonLine   = `2606:4700::1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 404 -`
+		escapedLine  = `8.8.8.8 - - [10/Oct/2000:13:55:36 -0700] "GET /\"q\" HTTP/1.1" 200 1 "-" "curl \"quoted\""`
+		jsonLine     = `{"remote_addr":"1.1.1.1","http_user_agent":"Mozilla/5.0 (compatible; bingbot/2.0)"}`
+		nestedLine   = `{"client":{"ip":"8.8.8.8, 10.0.0.1"},"request":{"ua":"curl/8.0"}}`
+		plainLine    = `Oct 10 13:55:36 sshd[123]: Failed password for root from 8.8.4.4 port 22 ssh2`
+	)
+
+	for _, tt := range []struct {
+		name   string
+		format Format
+		ip     string
+		ua     string
+		line   string
+		want   string
+		wantUA string
+	}{
+		{"combined", Combined, "", "", combinedLine, "1.1.1.1", "Mozilla/5.0 (compatible; Googlebot/2.1)"},
+		{"combined common", Combined, "", "", commonLine, "2606:4700::1", ""},
+		{"combined escaped quotes", Combined, "", "", escapedLine, "8.8.8.8", `curl "quoted"`},
+		{"combined invalid IP", Combined, "", "", `bogus - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200 1`, "", ""},
+		{"combined plain line", Combined, "", "", plainLine, "", ""},
+		{"json", JSON, "remote_addr", "http_user_agent", jsonLine, "1.1.1.1", "Mozilla/5.0 (compatible; bingbot/2.0)"},
+		{"json nested forwarded", JSON, "client.ip", "request.ua", nestedLine, "8.8.8.8", "curl/8.0"},
+		{"json missing field", JSON, "ip", "ua", jsonLine, "", ""},
+		{"json not an object", JSON, "ip", "ua", `["1.1.1.1"]`, "", ""},
+		{"json invalid", JSON, "ip", "ua", `{"ip":`, "", ""},
+		{"plain", Plain, "", "", plainLine, "8.8.4.4", ""},
+		{"plain quoted", Plain, "", "", `blocked ("2606:4700::1"), retrying`, "2606:4700::1", ""},
+		{"plain first IP", Plain, "", "", "1.1.1.1 -> 8.8.8.8", "1.1.1.1", ""},
+		{"plain no IP", Plain, "", "", "nothing here", "", ""},
+		{"auto combined", Auto, "remote_addr", "http_user_agent", combinedLine, "1.1.1.1", "Mozilla/5.0 (compatible; Googlebot/2.1)"},
+		{"auto json", Auto, "remote_addr", "http_user_agent", jsonLine, "1.1.1.1", "Mozilla/5.0 (compatible; bingbot/2.0)"},
+		{"auto plain", Auto, "remote_addr", "http_user_agent", plainLine, "8.8.4.4", ""},
+		{"auto invalid json", Auto, "remote_addr", "http_user_agent", `{"remote_addr":"1.1.1.1"`, "", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewParser(tt.format, tt.ip, tt.ua)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e, ok := p.Parse(tt.line)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("Parse() = %+v, want no entry", e)
+				}
+				return
+			}
+			if !ok || e.IP != netip.MustParseAddr(tt.want) || e.UserAgent != tt.wantUA {
+				t.Fatalf("Parse() = %+v %v, want %s %q", e, ok, tt.want, tt.wantUA)
+			}
+		})
+	}
+}
+
+func TestNewParser(t *testing.T) {
+	if _, err := NewParser("syslog", "ip", "ua"); err == nil {
+		t.Fatal("NewParser() of an unknown format returned no error")
+	}
+}
+
+func TestScan(t *testing.T) {
+	log := strings.Join([]string{
+		`1.1.1.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200 1 "-" "curl/8.0"`,
+		"",
+		`{"remote_addr":"8.8.8.8","http_user_agent":"Go-http-client/1.1"}`,
+		"no address",
+		"  client 2606:4700::1 connected  ",
+	}, "\n")
+
+	// an entry is read from a gzipped file as from plain text
+	dir := t.TempDir()
+	file := filepath.Join(dir, "access.log.gz")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write([]byte(log)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	plain := filepath.Join(dir, "access.log")
+	if err := os.WriteFile(plain, []byte(log), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewParser(Auto, "remote_addr", "http_user_agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{
+		{IP: netip.MustParseAddr("1.1.1.1"), UserAgent: "curl/8.0"},
+		{IP: netip.MustParseAddr("8.8.8.8"), UserAgent: "Go-http-client/1.1"},
+		{IP: netip.MustParseAddr("2606:4700::1")},
+	}
+
+	for _, file := range []string{file, plain} {
+		r, err := Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := []Entry{}
+		skipped, err := p.Scan(r, func(e Entry) {
+			entries = append(entries, e)
+		})
+		_ = r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(entries, want) || skipped != 1 {
+			t.Errorf("Scan() of %s = %+v, %d skipped, want %+v, 1 skipped", filepath.Base(file), entries, skipped, want)
+		}
+	}
+
+	if _, err := Open(filepath.Join(dir, "missing.log")); err == nil {
+		t.Error("Open() of a missing file returned no error")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bad.gz"), []byte("not gzip"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(filepath.Join(dir, "bad.gz")); err == nil {
+		t.Error("Open() of an invalid gzip file returned no error")
+	}
+}
@@ -6,10 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"iplists/cmd/internal/lib"
+	"iplists/internal/cidr"
 	"net/http"
 	"os"
 	"path"
-	"sort"
 	"time"
 )
 
@@ -102,7 +102,7 @@ func UpdateADBCache(key, cache string, days int) error {
 	for k := range existingIPs {
 		keys = append(keys, k)
 	}
-	sort.Strings(keys)
+	cidr.SortStrings(keys)
 
 	// build the updated list in order of IP addresses
 	updatedEntries := make([]Entry, 0, len(existingIPs))
@@ -0,0 +1,324 @@
+// Package awswaf provides the AWS WAFv2 IPSet API operations used to sync
+// lists.
+package awswaf
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iplists/cmd/internal/lib"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/signer"
+)
+
+const (
+	// MaxAddresses is the maximum number of addresses of an IPSet.
+	MaxAddresses = 10000
+	// targetPrefix is the JSON 1.1 protocol target prefix of WAFv2 operations.
+	targetPrefix = "AWSWAF_20190729."
+	// service is the SigV4 signing name of WAFv2.
+	service = "wafv2"
+	// pageSize is the number of IPSets fetched per request, the API maximum.
+	pageSize = 100
+	// maxRetries is the number of retries of an IPSet update that failed as
+	// the IPSet was changed concurrently.
+	maxRetries = 5
+)
+
+// ErrOptimisticLock is returned by UpdateIPSet when the IPSet has changed since
+// its LockToken was read.
+var ErrOptimisticLock = errors.New("ip set changed since it was read")
+
+// Client is an AWS WAFv2 API client.
+type Client struct {
+	endpoint        string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	http            *http.Client
+	// RetryInterval is the delay before the first retry of an IPSet update,
+	// increasing by the interval on each retry.
+	RetryInterval time.Duration
+}
+
+// IPSet is a WAFv2 IPSet.
+type IPSet struct {
+	Name             string   `json:"Name"`
+	ID               string   `json:"Id"`
+	ARN              string   `json:"ARN,omitempty"`
+	Description      string   `json:"Description,omitempty"`
+	IPAddressVersion string   `json:"IPAddressVersion"`
+	Addresses        []string `json:"Addresses"`
+}
+
+// APIError is an error returned by the API.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s (status %d)", e.Code, e.Message, e.Status)
+}
+
+// NewClientFromEnv creates a WAFv2 client of a region from environment
+// variables, the region endpoint is used if endpoint is empty.
+// Required env vars: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY
+// Optional env vars: AWS_SESSION_TOKEN
+func NewClientFromEnv(endpoint, region string) (*Client, error) {
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables must be set")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("region must be set")
+	}
+
+	if endpoint == "" {
+		endpoint = "https://wafv2." + region + ".amazonaws.com"
+	}
+
+	return &Client{
+		endpoint:        strings.TrimSuffix(endpoint, "/"),
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		http:            &http.Client{Timeout: 30 * time.Second},
+		RetryInterval:   time.Second,
+	}, nil
+}
+
+// IPSetID returns the ID of the IPSet of a name in a scope.
+func (c *Client) IPSetID(ctx context.Context, scope, name string) (string, error) {
+	input := struct {
+		Scope      string `json:"Scope"`
+		Limit      int    `json:"Limit"`
+		NextMarker string `json:"NextMarker,omitempty"`
+	}{Scope: scope, Limit: pageSize}
+
+	for {
+		var output struct {
+			NextMarker string  `json:"NextMarker"`
+			IPSets     []IPSet `json:"IPSets"`
+		}
+		if err := c.do(ctx, "ListIPSets", input, &output); err != nil {
+			return "", err
+		}
+
+		for _, set := range output.IPSets {
+			if set.Name == name {
+				return set.ID, nil
+			}
+		}
+
+		if output.NextMarker == "" || len(output.IPSets) == 0 {
+			return "", fmt.Errorf("ip set %s not found in scope %s", name, scope)
+		}
+		input.NextMarker = output.NextMarker
+	}
+}
+
+// GetIPSet returns an IPSet and the LockToken required to update it.
+func (c *Client) GetIPSet(ctx context.Context, scope, name, id string) (IPSet, string, error) {
+	input := struct {
+		Name  string `json:"Name"`
+		Scope string `json:"Scope"`
+		ID    string `json:"Id"`
+	}{name, scope, id}
+
+	var output struct {
+		IPSet     IPSet  `json:"IPSet"`
+		LockToken string `json:"LockToken"`
+	}
+	if err := c.do(ctx, "GetIPSet", input, &output); err != nil {
+		return IPSet{}, "", err
+	}
+
+	return output.IPSet, output.LockToken, nil
+}
+
+// UpdateIPSet replaces the addresses of an IPSet, keeping its description.
+// Returns ErrOptimisticLock if the IPSet has changed since lockToken was read.
+func (c *Client) UpdateIPSet(ctx context.Context, scope string, set IPSet, lockToken string) error {
+	input := struct {
+		Name        string   `json:"Name"`
+		Scope       string   `json:"Scope"`
+		ID          string   `json:"Id"`
+		Description string   `json:"Description,omitempty"`
+		Addresses   []string `json:"Addresses"`
+		LockToken   string   `json:"LockToken"`
+	}{set.Name, scope, set.ID, set.Description, set.Addresses, lockToken}
+
+	err := c.do(ctx, "UpdateIPSet", input, nil)
+	if apiErr := (*APIError)(nil); errors.As(err, &apiErr) && apiErr.Code == "WAFOptimisticLockException" {
+		return fmt.Errorf("%w: %s", ErrOptimisticLock, apiErr.Message)
+	}
+
+	return err
+}
+
+// SyncIPSet updates the addresses of an IPSet of a version, IPV4 or IPV6, to
+// the prefixes, returning the addresses added & removed. The IPSet is only
+// updated if they differ, and re-read & retried if it was changed since it was
+// read. With dryRun, the changes are returned without updating the IPSet.
+func (c *Client) SyncIPSet(ctx context.Context, scope, name, version string, prefixes []netip.Prefix, dryRun bool) (add, remove []string, err error) {
+	if len(prefixes) > MaxAddresses {
+		return nil, nil, fmt.Errorf("%s addresses exceed the limit of %s", lib.NumberFormat(len(prefixes)), lib.NumberFormat(MaxAddresses))
+	}
+
+	id, err := c.IPSetID(ctx, scope, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	addresses := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		addresses = append(addresses, p.String())
+	}
+
+	for attempt := 0; ; attempt++ {
+		set, lockToken, err := c.GetIPSet(ctx, scope, name, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		if set.IPAddressVersion != version {
+			return nil, nil, fmt.Errorf("ip set is %s, not %s", set.IPAddressVersion, version)
+		}
+
+		add, remove := Diff(set.Addresses, prefixes)
+		if dryRun || len(add) == 0 && len(remove) == 0 {
+			return add, remove, nil
+		}
+
+		set.Addresses = addresses
+		err = c.UpdateIPSet(ctx, scope, set, lockToken)
+		if errors.Is(err, ErrOptimisticLock) && attempt < maxRetries {
+			select {
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			case <-time.After(time.Duration(attempt+1) * c.RetryInterval):
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return add, remove, nil
+	}
+}
+
+// Diff returns the prefixes missing from the addresses of an IPSet, and the
+// addresses to remove: those not in the prefixes, duplicates and any
+// unparsable address. Addresses are compared as prefixes.
+func Diff(addresses []string, prefixes []netip.Prefix) (add, remove []string) {
+	local := map[netip.Prefix]bool{}
+	for _, p := range prefixes {
+		local[p] = true
+	}
+
+	remote := map[netip.Prefix]bool{}
+	remove = []string{}
+	for _, address := range addresses {
+		p, err := netip.ParsePrefix(address)
+		if err != nil || !local[p.Masked()] || remote[p.Masked()] {
+			remove = append(remove, address)
+			continue
+		}
+		remote[p.Masked()] = true
+	}
+
+	add = []string{}
+	for _, p := range prefixes {
+		if !remote[p] {
+			add = append(add, p.String())
+		}
+	}
+
+	return add, remove
+}
+
+// do sends a signed JSON 1.1 request of an operation, decoding the output
+// into v.
+func (c *Client) do(ctx context.Context, operation string, input, v any) error {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(payload)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", targetPrefix+operation)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	req = signer.SignV4WithServiceType(*req, c.accessKeyID, c.secretAccessKey, c.sessionToken, c.region, service)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		return apiError(operation, resp, b)
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(b, v); err != nil {
+			return fmt.Errorf("%s: %w", operation, err)
+		}
+	}
+
+	return nil
+}
+
+// apiError returns the error of a failed request, the code is the last part
+// of the error type, eg: com.amazonaws.wafv2#WAFNonexistentItemException.
+func apiError(operation string, resp *http.Response, body []byte) error {
+	var e struct {
+		Type         string `json:"__type"`
+		Message      string `json:"message"`
+		MessageUpper string `json:"Message"`
+	}
+	_ = json.Unmarshal(body, &e)
+
+	code := e.Type
+	if code == "" {
+		code, _, _ = strings.Cut(resp.Header.Get("X-Amzn-Errortype"), ":")
+	}
+	if i := strings.LastIndex(code, "#"); i >= 0 {
+		code = code[i+1:]
+	}
+	if code == "" {
+		code = http.StatusText(resp.StatusCode)
+	}
+
+	message := e.Message
+	if message == "" {
+		message = e.MessageUpper
+	}
+
+	return fmt.Errorf("%s: %w", operation, &APIError{Status: resp.StatusCode, Code: code, Message: message})
+}
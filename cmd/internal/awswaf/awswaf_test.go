@@ -0,0 +1,206 @@
+package awswaf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWAF is an in-memory WAFv2 API of a REGIONAL IPSet among 150 others.
+type fakeWAF struct {
+	mu        sync.Mutex
+	set       IPSet
+	lockToken int
+	// conflicts is the number of updates failing as if another writer had
+	// changed the IPSet, by changing its lock token.
+	conflicts  int
+	operations map[string]int
+}
+
+func newFakeWAF(t *testing.T, waf *fakeWAF) *Client {
+	t.Helper()
+
+	waf.operations = map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		waf.mu.Lock()
+		defer waf.mu.Unlock()
+
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/wafv2/aws4_request") {
+			writeError(w, http.StatusForbidden, "UnrecognizedClientException", "invalid signature")
+			return
+		}
+
+		operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), targetPrefix)
+		waf.operations[operation]++
+		var input struct {
+			Scope      string
+			NextMarker string
+			Name       string
+			ID         string `json:"Id"`
+			Addresses  []string
+			LockToken  string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeError(w, http.StatusBadRequest, "WAFInvalidParameterException", err.Error())
+			return
+		}
+
+		switch operation {
+		case "ListIPSets":
+			sets := []IPSet{}
+			for i := range 150 {
+				sets = append(sets, IPSet{Name: fmt.Sprintf("other-%d", i), ID: fmt.Sprintf("other-id-%d", i)})
+			}
+			sets = append(sets, waf.set)
+
+			page, next := sets[:100], "page-2"
+			if input.NextMarker == "page-2" {
+				page, next = sets[100:], ""
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"IPSets": page, "NextMarker": next})
+		case "GetIPSet":
+			if input.ID != waf.set.ID || input.Scope != "REGIONAL" {
+				writeError(w, http.StatusBadRequest, "WAFNonexistentItemException", "not found")
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"IPSet": waf.set, "LockToken": fmt.Sprint(waf.lockToken)})
+		case "UpdateIPSet":
+			if waf.conflicts > 0 {
+				waf.conflicts--
+				waf.lockToken++
+			}
+			if input.LockToken != fmt.Sprint(waf.lockToken) {
+				writeError(w, http.StatusBadRequest, "WAFOptimisticLockException", "stale lock token")
+				return
+			}
+			waf.set.Addresses = input.Addresses
+			waf.lockToken++
+			_ = json.NewEncoder(w).Encode(map[string]any{"NextLockToken": fmt.Sprint(waf.lockToken)})
+		default:
+			writeError(w, http.StatusBadRequest, "UnknownOperationException", operation)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	client, err := NewClientFromEnv(server.URL, "eu-west-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RetryInterval = time.Millisecond
+
+	return client
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"__type":  "com.amazonaws.wafv2#" + code,
+		"Message": message,
+	})
+}
+
+func TestDiff(t *testing.T) {
+	add, remove := Diff(
+		[]string{"192.0.2.1/32", "192.0.2.1/32", "198.51.100.0/24", "invalid", "203.0.113.1/24"},
+		[]netip.Prefix{netip.MustParsePrefix("192.0.2.1/32"), netip.MustParsePrefix("203.0.113.0/24"), netip.MustParsePrefix("2001:db8::/32")},
+	)
+
+	if want := []string{"2001:db8::/32"}; !slices.Equal(add, want) {
+		t.Errorf("add = %v, want %v", add, want)
+	}
+	if want := []string{"192.0.2.1/32", "198.51.100.0/24", "invalid"}; !slices.Equal(remove, want) {
+		t.Errorf("remove = %v, want %v", remove, want)
+	}
+}
+
+func TestSyncIPSet(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("203.0.113.7/32")}
+
+	for _, tt := range []struct {
+		name      string
+		conflicts int
+		dryRun    bool
+		addresses []string
+		wantAdd   []string
+		wantErr   error
+		updates   int
+	}{
+		{"updated", 0, false, []string{"192.0.2.0/24", "198.51.100.0/24"}, []string{"203.0.113.7/32"}, nil, 1},
+		{"retried", 2, false, []string{"192.0.2.0/24", "198.51.100.0/24"}, []string{"203.0.113.7/32"}, nil, 3},
+		{"retries exhausted", 10, false, []string{"192.0.2.0/24", "198.51.100.0/24"}, nil, ErrOptimisticLock, maxRetries + 1},
+		{"dry run", 0, true, []string{"192.0.2.0/24", "198.51.100.0/24"}, []string{"203.0.113.7/32"}, nil, 0},
+		{"up to date", 0, false, []string{"203.0.113.7/32", "192.0.2.0/24"}, []string{}, nil, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			waf := &fakeWAF{
+				set:       IPSet{Name: "blocked", ID: "blocked-id", IPAddressVersion: "IPV4", Addresses: tt.addresses},
+				conflicts: tt.conflicts,
+			}
+			client := newFakeWAF(t, waf)
+
+			add, _, err := client.SyncIPSet(context.Background(), "REGIONAL", "blocked", "IPV4", prefixes, tt.dryRun)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SyncIPSet() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(add, tt.wantAdd) {
+				t.Errorf("added %v, want %v", add, tt.wantAdd)
+			}
+
+			if waf.operations["UpdateIPSet"] != tt.updates {
+				t.Errorf("%d updates, want %d", waf.operations["UpdateIPSet"], tt.updates)
+			}
+			if waf.operations["GetIPSet"] != max(tt.updates, 1) {
+				t.Errorf("IPSet read %d times, want once per update", waf.operations["GetIPSet"])
+			}
+
+			want := []string{"192.0.2.0/24", "203.0.113.7/32"}
+			if tt.wantErr != nil || tt.dryRun || tt.updates == 0 {
+				want = tt.addresses
+			}
+			if !slices.Equal(waf.set.Addresses, want) {
+				t.Errorf("IPSet addresses = %v, want %v", waf.set.Addresses, want)
+			}
+		})
+	}
+}
+
+func TestSyncIPSetErrors(t *testing.T) {
+	waf := &fakeWAF{set: IPSet{Name: "blocked", ID: "blocked-id", IPAddressVersion: "IPV6"}}
+	client := newFakeWAF(t, waf)
+	ctx := context.Background()
+	prefixes := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+
+	if _, _, err := client.SyncIPSet(ctx, "REGIONAL", "blocked", "IPV4", prefixes, false); err == nil || err.Error() != "ip set is IPV6, not IPV4" {
+		t.Errorf("version mismatch error = %v", err)
+	}
+	if _, _, err := client.SyncIPSet(ctx, "REGIONAL", "missing", "IPV4", prefixes, false); err == nil || err.Error() != "ip set missing not found in scope REGIONAL" {
+		t.Errorf("missing IPSet error = %v", err)
+	}
+	if _, _, err := client.SyncIPSet(ctx, "REGIONAL", "blocked", "IPV4", make([]netip.Prefix, MaxAddresses+1), false); err == nil {
+		t.Error("no error exceeding MaxAddresses")
+	}
+
+	var apiErr *APIError
+	_, _, err := client.GetIPSet(ctx, "CLOUDFRONT", "blocked", "blocked-id")
+	if !errors.As(err, &apiErr) || apiErr.Code != "WAFNonexistentItemException" || apiErr.Status != http.StatusBadRequest || apiErr.Message != "not found" {
+		t.Errorf("GetIPSet() error = %#v, want a WAFNonexistentItemException APIError", err)
+	}
+
+	client.secretAccessKey = ""
+	client.accessKeyID = "other"
+	if _, err := client.IPSetID(ctx, "REGIONAL", "blocked"); !errors.As(err, &apiErr) || apiErr.Code != "UnrecognizedClientException" {
+		t.Errorf("IPSetID() error = %v, want UnrecognizedClientException", err)
+	}
+}
@@ -0,0 +1,300 @@
+// Package cloudflare provides the Cloudflare account IP Lists API operations
+// used to sync lists.
+package cloudflare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iplists/internal/cidr"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the base URL of the Cloudflare API.
+const DefaultBaseURL = "https://api.cloudflare.com/client/v4"
+
+const (
+	// pageSize is the number of items fetched per request, the API maximum.
+	pageSize = 500
+	// batchSize is the number of items added or deleted per bulk operation.
+	batchSize = 1000
+	// maxRetries is the number of retries of a rate limited request.
+	maxRetries = 5
+)
+
+// Client is a Cloudflare API client.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+	// PollInterval is the interval between checks of a bulk operation.
+	PollInterval time.Duration
+}
+
+// Item is an item of an IP List.
+type Item struct {
+	ID      string `json:"id,omitempty"`
+	IP      string `json:"ip"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type list struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+type operation struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+// response is the envelope of every API response.
+type response struct {
+	Success    bool            `json:"success"`
+	Errors     []apiError      `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo struct {
+		Cursors struct {
+			After string `json:"after"`
+		} `json:"cursors"`
+	} `json:"result_info"`
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewClient returns a client of the API at baseURL, DefaultBaseURL if empty,
+// authenticating with an API token.
+func NewClient(baseURL, token string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		token:        token,
+		http:         &http.Client{Timeout: 30 * time.Second},
+		PollInterval: time.Second,
+	}
+}
+
+// ListID returns the ID of the IP List of a name.
+func (c *Client) ListID(ctx context.Context, account, name string) (string, error) {
+	var lists []list
+	if _, err := c.do(ctx, http.MethodGet, "/accounts/"+account+"/rules/lists", nil, &lists); err != nil {
+		return "", err
+	}
+
+	for _, l := range lists {
+		if l.Name == name {
+			if l.Kind != "ip" {
+				return "", fmt.Errorf("list %s is a %s list, not an ip list", name, l.Kind)
+			}
+			return l.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("list %s not found", name)
+}
+
+// Items returns every item of an IP List.
+func (c *Client) Items(ctx context.Context, account, listID string) ([]Item, error) {
+	items := []Item{}
+	cursor := ""
+	for {
+		query := url.Values{"per_page": {strconv.Itoa(pageSize)}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+
+		var page []Item
+		resp, err := c.do(ctx, http.MethodGet, "/accounts/"+account+"/rules/lists/"+listID+"/items?"+query.Encode(), nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+
+		cursor = resp.ResultInfo.Cursors.After
+		if cursor == "" || len(page) == 0 {
+			return items, nil
+		}
+	}
+}
+
+// AddItems adds items to an IP List, waiting for each bulk operation.
+func (c *Client) AddItems(ctx context.Context, account, listID string, items []Item) error {
+	for start := 0; start < len(items); start += batchSize {
+		batch := items[start:min(start+batchSize, len(items))]
+		if err := c.bulk(ctx, http.MethodPost, account, listID, batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteItems deletes items from an IP List by ID, waiting for each bulk
+// operation.
+func (c *Client) DeleteItems(ctx context.Context, account, listID string, ids []string) error {
+	for start := 0; start < len(ids); start += batchSize {
+		type itemID struct {
+			ID string `json:"id"`
+		}
+		batch := struct {
+			Items []itemID `json:"items"`
+		}{}
+		for _, id := range ids[start:min(start+batchSize, len(ids))] {
+			batch.Items = append(batch.Items, itemID{ID: id})
+		}
+		if err := c.bulk(ctx, http.MethodDelete, account, listID, batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Diff returns the items to add to an IP List of items to list the prefixes,
+// with the comment, and the items to delete: those not in the prefixes,
+// duplicates and any unparsable item.
+func Diff(items []Item, prefixes []netip.Prefix, comment string) (add, remove []Item) {
+	local := map[netip.Prefix]bool{}
+	for _, p := range prefixes {
+		local[p] = true
+	}
+
+	remote := map[netip.Prefix]bool{}
+	remove = []Item{}
+	for _, item := range items {
+		p, err := cidr.Parse(item.IP)
+		if err != nil || !local[p] || remote[p] {
+			remove = append(remove, item)
+			continue
+		}
+		remote[p] = true
+	}
+
+	add = []Item{}
+	for _, p := range prefixes {
+		if !remote[p] {
+			add = append(add, Item{IP: cidr.Format(p), Comment: comment})
+		}
+	}
+
+	return add, remove
+}
+
+// bulk starts a bulk operation on the items of an IP List and waits for it.
+func (c *Client) bulk(ctx context.Context, method, account, listID string, body any) error {
+	var op struct {
+		OperationID string `json:"operation_id"`
+	}
+	if _, err := c.do(ctx, method, "/accounts/"+account+"/rules/lists/"+listID+"/items", body, &op); err != nil {
+		return err
+	}
+
+	return c.wait(ctx, account, op.OperationID)
+}
+
+// wait polls a bulk operation until it has completed.
+func (c *Client) wait(ctx context.Context, account, operationID string) error {
+	for {
+		var op operation
+		if _, err := c.do(ctx, http.MethodGet, "/accounts/"+account+"/rules/lists/bulk_operations/"+operationID, nil, &op); err != nil {
+			return err
+		}
+
+		switch op.Status {
+		case "completed":
+			return nil
+		case "failed":
+			return fmt.Errorf("bulk operation %s failed: %s", operationID, op.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.PollInterval):
+		}
+	}
+}
+
+// do sends a request, decoding the result into v, and retrying when rate
+// limited after the Retry-After delay, or an exponential backoff.
+func (c *Client) do(ctx context.Context, method, path string, body, v any) (*response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries {
+			delay := backoff
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				delay = time.Duration(seconds) * time.Second
+			}
+			backoff *= 2
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			continue
+		}
+
+		var r response
+		if err := json.Unmarshal(b, &r); err != nil {
+			return nil, fmt.Errorf("%s %s: status %d: %w", method, path, resp.StatusCode, err)
+		}
+		if !r.Success || resp.StatusCode >= 300 {
+			messages := []string{}
+			for _, e := range r.Errors {
+				messages = append(messages, fmt.Sprintf("%s (%d)", e.Message, e.Code))
+			}
+			return nil, fmt.Errorf("%s %s: status %d: %s", method, path, resp.StatusCode, strings.Join(messages, ", "))
+		}
+
+		if v != nil {
+			if err := json.Unmarshal(r.Result, v); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+		}
+
+		return &r, nil
+	}
+}
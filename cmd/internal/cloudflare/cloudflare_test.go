@@ -0,0 +1,286 @@
+package cloudflare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iplists/internal/cidr"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPI is an in-memory IP Lists API of a single account, applying bulk
+// operations immediately but reporting them pending for a poll.
+type fakeAPI struct {
+	mu       sync.Mutex
+	items    []Item
+	nextID   int
+	polls    map[string]int
+	failed   bool
+	requests map[string]int
+	// limit is the number of requests answered with a 429 before any other.
+	limit int
+}
+
+func newFakeAPI(t *testing.T, api *fakeAPI) *Client {
+	t.Helper()
+
+	api.polls = map[string]int{}
+	api.requests = map[string]int{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /accounts/acc/rules/lists", func(w http.ResponseWriter, _ *http.Request) {
+		writeResult(w, []list{
+			{ID: "hosts-id", Name: "hosts", Kind: "hostname"},
+			{ID: "list-id", Name: "blocked", Kind: "ip"},
+		}, "")
+	})
+	mux.HandleFunc("GET /accounts/acc/rules/lists/list-id/items", func(w http.ResponseWriter, r *http.Request) {
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		start, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+		end := min(start+perPage, len(api.items))
+
+		after := ""
+		if end < len(api.items) {
+			after = strconv.Itoa(end)
+		}
+		writeResult(w, api.items[start:end], after)
+	})
+	mux.HandleFunc("POST /accounts/acc/rules/lists/list-id/items", func(w http.ResponseWriter, r *http.Request) {
+		var items []Item
+		if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, item := range items {
+			api.nextID++
+			item.ID = fmt.Sprintf("item-%d", api.nextID)
+			api.items = append(api.items, item)
+		}
+		api.bulk(w)
+	})
+	mux.HandleFunc("DELETE /accounts/acc/rules/lists/list-id/items", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Items []Item `json:"items"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		api.items = slices.DeleteFunc(api.items, func(item Item) bool {
+			return slices.ContainsFunc(body.Items, func(deleted Item) bool { return deleted.ID == item.ID })
+		})
+		api.bulk(w)
+	})
+	mux.HandleFunc("GET /accounts/acc/rules/lists/bulk_operations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		op := operation{ID: id, Status: "completed"}
+		switch {
+		case api.polls[id] == 0 && api.failed:
+			op.Status, op.Error = "failed", "list full"
+		case api.polls[id] == 0:
+			op.Status = "pending"
+		}
+		api.polls[id]++
+		writeResult(w, op, "")
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+
+		api.requests[r.Method]++
+		if r.Header.Get("Authorization") != "Bearer token" {
+			writeError(w, http.StatusForbidden, "Authentication error")
+			return
+		}
+		if api.limit > 0 {
+			api.limit--
+			w.Header().Set("Retry-After", "0")
+			writeError(w, http.StatusTooManyRequests, "Rate limited")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL+"/", "token")
+	client.PollInterval = time.Millisecond
+
+	return client
+}
+
+// bulk writes the response of a new bulk operation.
+func (api *fakeAPI) bulk(w http.ResponseWriter) {
+	id := fmt.Sprintf("op-%d", len(api.polls)+1)
+	api.polls[id] = 0
+	writeResult(w, map[string]string{"operation_id": id}, "")
+}
+
+func writeResult(w http.ResponseWriter, result any, after string) {
+	r := map[string]any{"success": true, "errors": []any{}, "result": result}
+	if after != "" {
+		r["result_info"] = map[string]any{"cursors": map[string]string{"after": after}}
+	}
+	_ = json.NewEncoder(w).Encode(r)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"success": false,
+		"errors":  []apiError{{Code: 10000, Message: message}},
+	})
+}
+
+func prefixes(start, n int) []netip.Prefix {
+	prefixes := make([]netip.Prefix, n)
+	for i := range prefixes {
+		addr := netip.AddrFrom4([4]byte{10, byte((start + i) >> 8), byte(start + i), 0})
+		prefixes[i] = netip.PrefixFrom(addr, 24)
+	}
+
+	return prefixes
+}
+
+func TestDiff(t *testing.T) {
+	items := []Item{
+		{ID: "1", IP: "192.0.2.1"},
+		{ID: "2", IP: "192.0.2.1/32"},
+		{ID: "3", IP: "198.51.100.0/24"},
+		{ID: "4", IP: "not an ip"},
+		{ID: "5", IP: "2001:db8::/64"},
+	}
+	local := []netip.Prefix{
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("203.0.113.0/24"),
+		netip.MustParsePrefix("2001:db8::/64"),
+		netip.MustParsePrefix("2001:db8:1::/64"),
+	}
+
+	add, remove := Diff(items, local, "blocked")
+	wantAdd := []Item{{IP: "203.0.113.0/24", Comment: "blocked"}, {IP: "2001:db8:1::/64", Comment: "blocked"}}
+	if !slices.Equal(add, wantAdd) {
+		t.Errorf("add = %v, want %v", add, wantAdd)
+	}
+	if wantRemove := []Item{items[1], items[2], items[3]}; !slices.Equal(remove, wantRemove) {
+		t.Errorf("remove = %v, want %v", remove, wantRemove)
+	}
+
+	add, remove = Diff(items[:1], local[:1], "blocked")
+	if len(add) != 0 || len(remove) != 0 {
+		t.Errorf("up to date list: add = %v, remove = %v", add, remove)
+	}
+}
+
+func TestClientSync(t *testing.T) {
+	api := &fakeAPI{limit: 2}
+	// 1,200 items over 3 pages, of which the first 600 are kept, and a
+	// duplicate & an unparsable item
+	for _, p := range prefixes(0, 1200) {
+		api.nextID++
+		api.items = append(api.items, Item{ID: fmt.Sprintf("item-%d", api.nextID), IP: p.String()})
+	}
+	api.items = append(api.items, Item{ID: "duplicate", IP: "10.0.0.0/24"}, Item{ID: "invalid", IP: "-"})
+	client := newFakeAPI(t, api)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	listID, err := client.ListID(ctx, "acc", "blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listID != "list-id" {
+		t.Fatalf("ListID() = %s, want list-id", listID)
+	}
+
+	items, err := client.Items(ctx, "acc", listID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1202 {
+		t.Fatalf("Items() returned %d items, want 1202", len(items))
+	}
+
+	// 600 kept and 1,500 added in 2 bulk operations
+	local := slices.Concat(prefixes(0, 600), prefixes(2000, 1500))
+	add, remove := Diff(items, local, "blocked")
+	if len(add) != 1500 || len(remove) != 602 {
+		t.Fatalf("Diff() = %d to add & %d to remove, want 1500 & 602", len(add), len(remove))
+	}
+	if err := client.AddItems(ctx, "acc", listID, add); err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, item := range remove {
+		ids = append(ids, item.ID)
+	}
+	if err := client.DeleteItems(ctx, "acc", listID, ids); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []netip.Prefix{}
+	for _, item := range api.items {
+		p, err := cidr.Parse(item.IP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p)
+	}
+	cidr.Sort(got)
+	if !slices.Equal(got, local) {
+		t.Fatalf("list has %d items, want the %d prefixes", len(got), len(local))
+	}
+
+	if api.requests[http.MethodPost] != 2 || api.requests[http.MethodDelete] != 1 {
+		t.Errorf("%d adds & %d deletes, want 2 & 1", api.requests[http.MethodPost], api.requests[http.MethodDelete])
+	}
+	for id, polls := range api.polls {
+		if polls != 2 {
+			t.Errorf("operation %s polled %d times, want until completed after 2", id, polls)
+		}
+	}
+	if api.limit != 0 {
+		t.Errorf("%d rate limited requests not sent", api.limit)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	api := &fakeAPI{failed: true}
+	client := newFakeAPI(t, api)
+
+	for _, tt := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"not found", errorOf(client.ListID(ctx, "acc", "missing")), "list missing not found"},
+		{"not an ip list", errorOf(client.ListID(ctx, "acc", "hosts")), "list hosts is a hostname list, not an ip list"},
+		{"failed operation", client.AddItems(ctx, "acc", "list-id", []Item{{IP: "192.0.2.1"}}), "bulk operation op-1 failed: list full"},
+		{"api error", errorOf(client.Items(ctx, "acc", "missing-id")), "status 404"},
+	} {
+		if tt.err == nil || !strings.Contains(tt.err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, tt.err, tt.want)
+		}
+	}
+
+	client.token = "wrong"
+	if _, err := client.ListID(ctx, "acc", "blocked"); err == nil || !strings.Contains(err.Error(), "Authentication error (10000)") {
+		t.Errorf("error = %v, want the API error message", err)
+	}
+}
+
+func errorOf[T any](_ T, err error) error {
+	return err
+}
@@ -0,0 +1,256 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"iplists/internal/cidr"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+const (
+	// awsSetSize is the maximum number of addresses of an AWS WAFv2 IPSet.
+	awsSetSize = 10000
+	// azureSetSize is the maximum number of IPs of an Azure WAF custom rule.
+	azureSetSize = 600
+	// azurePriority is the priority of the first Azure WAF custom rule.
+	azurePriority = 100
+	// awsMaxName & azureMaxName are the maximum lengths of a set or rule name,
+	// less the room for the family & number suffixes.
+	awsMaxName   = 128 - len("-v4-10000")
+	azureMaxName = 128 - len("10000")
+	// awsMaxDescription is the maximum length of an IPSet description.
+	awsMaxDescription = 256
+)
+
+// awsUnsafe matches the characters not allowed in an IPSet description.
+var awsUnsafe = regexp.MustCompile(`[^A-Za-z0-9_+=:#@/\-,. ]+`)
+
+func init() {
+	Register("cloudflare", Format{
+		Description: "Cloudflare IP List items JSON, with the list name as comment",
+		ContentType: "application/json",
+		Write:       writeCloudflare,
+	})
+	Register("aws-waf", Format{
+		Description: "AWS WAFv2 IPSets JSON, split by family & size limit",
+		ContentType: "application/json",
+		Write:       writeAWS,
+	})
+	Register("azure-waf", Format{
+		Description: "Azure WAF custom rules JSON, split by size limit",
+		ContentType: "application/json",
+		Write:       writeAzure,
+	})
+}
+
+type cloudflareItem struct {
+	IP      string `json:"ip"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// writeCloudflare writes the items of a Cloudflare account IP List, the body
+// of a create or replace items request. Cloudflare only accepts IPv4 prefixes
+// of /8 to /32 and IPv6 prefixes of /12 to /64, so longer IPv6 prefixes are
+// widened to their /64 and shorter prefixes are split.
+func writeCloudflare(w io.Writer, lists []List, _ Options) error {
+	items := []cloudflareItem{}
+	for _, l := range lists {
+		for _, p := range CloudflarePrefixes(l.Prefixes) {
+			items = append(items, cloudflareItem{IP: cidr.Format(p), Comment: l.Name})
+		}
+	}
+
+	return writeJSON(w, items)
+}
+
+// CloudflarePrefixes returns the prefixes limited to the prefix lengths
+// accepted by Cloudflare IP Lists.
+func CloudflarePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	return limitBits(prefixes, 8, 12, 64)
+}
+
+type awsIPSet struct {
+	Name             string   `json:"Name"`
+	Scope            string   `json:"Scope"`
+	IPAddressVersion string   `json:"IPAddressVersion"`
+	Description      string   `json:"Description"`
+	Addresses        []string `json:"Addresses"`
+}
+
+// writeAWS writes AWS WAFv2 IPSets, the input of CreateIPSet without the
+// LockToken. An IPSet is a single family and is limited to 10,000 addresses
+// (or SetSize), larger lists are split into numbered sets. Addresses always
+// include the prefix length. Uses the Scope & SetSize options.
+func writeAWS(w io.Writer, lists []List, opts Options) error {
+	size := opts.SetSize
+	if size <= 0 {
+		size = awsSetSize
+	}
+
+	sets := []awsIPSet{}
+	for _, l := range lists {
+		for _, family := range l.Families() {
+			version := "IPV4"
+			if family.IPv6 {
+				version = "IPV6"
+			}
+
+			parts := chunks(family.Prefixes, size)
+			for i, chunk := range parts {
+				name := truncate(slug(l.Name), awsMaxName) + "-" + family.Suffix
+				if len(parts) > 1 {
+					name = fmt.Sprintf("%s-%d", name, i+1)
+				}
+
+				addresses := make([]string, 0, len(chunk))
+				for _, p := range chunk {
+					addresses = append(addresses, p.String())
+				}
+
+				sets = append(sets, awsIPSet{
+					Name:             name,
+					Scope:            opts.Scope,
+					IPAddressVersion: version,
+					Description:      awsDescription(l.Name, fmt.Sprintf("%s %d of %d", family.Suffix, i+1, len(parts))),
+					Addresses:        addresses,
+				})
+			}
+		}
+	}
+
+	return writeJSON(w, sets)
+}
+
+type azureRule struct {
+	Name            string                `json:"name"`
+	Priority        int                   `json:"priority"`
+	RuleType        string                `json:"ruleType"`
+	Action          string                `json:"action"`
+	MatchConditions []azureMatchCondition `json:"matchConditions"`
+}
+
+type azureMatchCondition struct {
+	MatchVariables []azureMatchVariable `json:"matchVariables"`
+	Operator       string               `json:"operator"`
+	MatchValues    []string             `json:"matchValues"`
+}
+
+type azureMatchVariable struct {
+	VariableName string `json:"variableName"`
+}
+
+// writeAzure writes Azure WAF policy custom rules matching the remote address.
+// A rule is limited to 600 IPs (or SetSize), larger lists are split into
+// numbered rules of increasing priority. Uses the Action & SetSize options.
+func writeAzure(w io.Writer, lists []List, opts Options) error {
+	size := opts.SetSize
+	if size <= 0 {
+		size = azureSetSize
+	}
+
+	action := "Block"
+	if opts.Action == "allow" {
+		action = "Allow"
+	}
+
+	rules := []azureRule{}
+	for _, l := range lists {
+		parts := chunks(l.Prefixes, size)
+		for i, chunk := range parts {
+			name := azureName(l.Name)
+			if len(parts) > 1 {
+				name = fmt.Sprintf("%s%d", name, i+1)
+			}
+
+			values := make([]string, 0, len(chunk))
+			for _, p := range chunk {
+				values = append(values, cidr.Format(p))
+			}
+
+			rules = append(rules, azureRule{
+				Name:     name,
+				Priority: azurePriority + len(rules),
+				RuleType: "MatchRule",
+				Action:   action,
+				MatchConditions: []azureMatchCondition{{
+					MatchVariables: []azureMatchVariable{{VariableName: "RemoteAddr"}},
+					Operator:       "IPMatch",
+					MatchValues:    values,
+				}},
+			})
+		}
+	}
+
+	return writeJSON(w, rules)
+}
+
+// awsDescription returns the description of an IPSet of a list, eg:
+// "tor-exit v4 1 of 2", of the characters & length accepted by WAFv2.
+func awsDescription(name, part string) string {
+	name = strings.TrimSpace(awsUnsafe.ReplaceAllString(name, "-"))
+
+	return strings.TrimSpace(truncate(name, awsMaxDescription-len(part)-1) + " " + part)
+}
+
+// azureName returns a name of letters & digits only, starting with a letter.
+func azureName(name string) string {
+	name = strings.ReplaceAll(Identifier(name), "_", "")
+	if name == "" || name[0] <= '9' {
+		name = "list" + name
+	}
+
+	return truncate(name, azureMaxName)
+}
+
+// truncate returns s cut to at most n bytes, s being ASCII.
+func truncate(s string, n int) string {
+	return s[:min(len(s), n)]
+}
+
+// limitBits returns the prefixes with IPv6 prefixes longer than max6 widened,
+// and prefixes shorter than min4 or min6 split into prefixes of that length.
+func limitBits(prefixes []netip.Prefix, min4, min6, max6 int) []netip.Prefix {
+	widened := make([]netip.Prefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.Addr().Is6() && p.Bits() > max6 {
+			p = netip.PrefixFrom(p.Addr(), max6).Masked()
+		}
+		widened = append(widened, p)
+	}
+
+	// widened prefixes may now overlap
+	limited := []netip.Prefix{}
+	for _, p := range cidr.Aggregate(widened) {
+		minBits := min4
+		if p.Addr().Is6() {
+			minBits = min6
+		}
+
+		if p.Bits() >= minBits {
+			limited = append(limited, p)
+			continue
+		}
+
+		// split into prefixes of minBits
+		last := cidr.Last(p)
+		for sub := netip.PrefixFrom(p.Addr(), minBits); ; {
+			limited = append(limited, sub)
+			if sub.Contains(last) {
+				break
+			}
+			sub = netip.PrefixFrom(cidr.Last(sub).Next(), minBits)
+		}
+	}
+
+	return limited
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
@@ -0,0 +1,168 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"iplists/internal/cidr"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var (
+	// the WAFv2 CreateIPSet Name & Description patterns
+	awsNamePattern        = regexp.MustCompile(`^[\w\-]{1,128}$`)
+	awsDescriptionPattern = regexp.MustCompile(`^[\w+=:#@/\-,\.][\w+=:#@/\-,\.\s]+[\w+=:#@/\-,\.]$`)
+	// an Azure WAF custom rule name
+	azureNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]{0,127}$`)
+)
+
+// cloudLists returns lists named to test the name limits, of which the first
+// exceeds the set size of every service.
+func cloudLists() []List {
+	large := []netip.Prefix{}
+	for i := range 25000 {
+		large = append(large, netip.PrefixFrom(netip.AddrFrom4([4]byte{10, byte(i >> 8), byte(i), 0}), 24))
+	}
+	for i := range 700 {
+		large = append(large, netip.PrefixFrom(netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, byte(i >> 8), byte(i)}), 48))
+	}
+
+	small := []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32"), netip.MustParsePrefix("2001:db8::1/128")}
+
+	return []List{
+		{Name: "tor exit (nodes)", Prefixes: large},
+		{Name: "1-bad", Prefixes: small},
+		{Name: " ñandú ", Prefixes: small},
+		{Name: strings.Repeat("long-name.", 30), Prefixes: small},
+	}
+}
+
+// listedPrefixes returns the prefixes of the lists, sorted.
+func listedPrefixes(lists []List) []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	for _, l := range lists {
+		prefixes = append(prefixes, l.Prefixes...)
+	}
+	cidr.Sort(prefixes)
+
+	return prefixes
+}
+
+func TestWriteAWSLimits(t *testing.T) {
+	lists := cloudLists()
+
+	var b bytes.Buffer
+	if err := Write(&b, "aws-waf", lists, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var sets []awsIPSet
+	if err := json.Unmarshal(b.Bytes(), &sets); err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{}
+	got := []netip.Prefix{}
+	for _, set := range sets {
+		if !awsNamePattern.MatchString(set.Name) || names[set.Name] {
+			t.Errorf("invalid or duplicate name %q", set.Name)
+		}
+		names[set.Name] = true
+		if !awsDescriptionPattern.MatchString(set.Description) || len(set.Description) > 256 {
+			t.Errorf("invalid description %q", set.Description)
+		}
+		if set.Scope != "REGIONAL" {
+			t.Errorf("%s scope = %s, want REGIONAL", set.Name, set.Scope)
+		}
+		if len(set.Addresses) == 0 || len(set.Addresses) > 10000 {
+			t.Errorf("%s has %d addresses, want 1 to 10,000", set.Name, len(set.Addresses))
+		}
+
+		for _, address := range set.Addresses {
+			// addresses must include the prefix length
+			p, err := netip.ParsePrefix(address)
+			if err != nil {
+				t.Fatalf("%s: %v", set.Name, err)
+			}
+			if p.Addr().Is6() != (set.IPAddressVersion == "IPV6") {
+				t.Errorf("%s of %s is not %s", address, set.Name, set.IPAddressVersion)
+			}
+			got = append(got, p)
+		}
+	}
+
+	cidr.Sort(got)
+	if !slices.Equal(got, listedPrefixes(lists)) {
+		t.Errorf("sets have %d addresses, want each of the %d prefixes once", len(got), len(listedPrefixes(lists)))
+	}
+	if !names["tor-exit-nodes-v4-3"] || !names["tor-exit-nodes-v6"] {
+		t.Errorf("names = %v, want the first list split into 3 IPv4 sets and 1 IPv6 set", names)
+	}
+}
+
+func TestWriteAzureLimits(t *testing.T) {
+	lists := cloudLists()
+
+	var b bytes.Buffer
+	if err := Write(&b, "azure-waf", lists, Options{Action: "allow"}); err != nil {
+		t.Fatal(err)
+	}
+	var rules []azureRule
+	if err := json.Unmarshal(b.Bytes(), &rules); err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{}
+	priorities := map[int]bool{}
+	got := []netip.Prefix{}
+	for _, rule := range rules {
+		if !azureNamePattern.MatchString(rule.Name) || names[rule.Name] {
+			t.Errorf("invalid or duplicate name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Priority < 1 || priorities[rule.Priority] {
+			t.Errorf("invalid or duplicate priority %d of %s", rule.Priority, rule.Name)
+		}
+		priorities[rule.Priority] = true
+		if rule.Action != "Allow" || rule.RuleType != "MatchRule" || len(rule.MatchConditions) != 1 {
+			t.Fatalf("%s = %+v", rule.Name, rule)
+		}
+
+		values := rule.MatchConditions[0].MatchValues
+		if len(values) == 0 || len(values) > 600 {
+			t.Errorf("%s has %d values, want 1 to 600", rule.Name, len(values))
+		}
+		for _, value := range values {
+			p, err := cidr.Parse(value)
+			if err != nil {
+				t.Fatalf("%s: %v", rule.Name, err)
+			}
+			got = append(got, p)
+		}
+	}
+
+	cidr.Sort(got)
+	if !slices.Equal(got, listedPrefixes(lists)) {
+		t.Errorf("rules have %d values, want each of the %d prefixes once", len(got), len(listedPrefixes(lists)))
+	}
+}
+
+func TestWriteCloudSetSize(t *testing.T) {
+	lists := []List{{Name: "blocked", Prefixes: listedPrefixes(cloudLists()[:1])[:250]}}
+
+	for format, want := range map[string]int{"aws-waf": 3, "azure-waf": 3} {
+		var b bytes.Buffer
+		if err := Write(&b, format, lists, Options{SetSize: 100}); err != nil {
+			t.Fatal(err)
+		}
+		var sets []json.RawMessage
+		if err := json.Unmarshal(b.Bytes(), &sets); err != nil {
+			t.Fatal(err)
+		}
+		if len(sets) != want {
+			t.Errorf("%s wrote %d sets of 250 entries by 100, want %d", format, len(sets), want)
+		}
+	}
+}
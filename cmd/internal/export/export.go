@@ -0,0 +1,213 @@
+// Package export converts lists into the configuration formats of firewalls,
+// web servers and WAFs.
+package export
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// List is a named list of aggregated prefixes to export.
+type List struct {
+	Name     string
+	Prefixes []netip.Prefix
+}
+
+// IPv4 returns the IPv4 prefixes of the list.
+func (l List) IPv4() []netip.Prefix {
+	return family(l.Prefixes, true)
+}
+
+// IPv6 returns the IPv6 prefixes of the list.
+func (l List) IPv6() []netip.Prefix {
+	return family(l.Prefixes, false)
+}
+
+// Family is the prefixes of a list of one address family.
+type Family struct {
+	// Suffix is appended to the list name to name the family, "v4" or "v6".
+	Suffix   string
+	IPv6     bool
+	Prefixes []netip.Prefix
+}
+
+// Families returns the IPv4 & IPv6 prefixes of the list, for formats with a
+// set, list or route table per family.
+func (l List) Families() []Family {
+	return []Family{
+		{"v4", false, l.IPv4()},
+		{"v6", true, l.IPv6()},
+	}
+}
+
+// Options are the format specific options, each format documents those it
+// uses and ignores the rest.
+type Options struct {
+	// Family & Table are the nftables family and table of the sets.
+	Family string
+	Table  string
+	// ChunkSize is the maximum number of elements added by a single command.
+	ChunkSize int
+	// Variable is the nginx geo variable.
+	Variable string
+	// Values are the values of the entries of each list, by list name, for
+	// nginx geo blocks & HAProxy maps. The "" key is the value of any other list.
+	Values map[string]string
+	// Action is "allow" or "deny", for nginx & Apache access rules and Azure
+	// WAF custom rules.
+	Action string
+	// Scope is the AWS WAFv2 scope of IPSets, REGIONAL or CLOUDFRONT.
+	Scope string
+	// SetSize is the maximum number of entries of a set or rule, for formats
+	// with a size limit, 0 for the limit of the service.
+	SetSize int
+	// Timeout is the RouterOS duration of MikroTik address-list entries, eg:
+	// "1d", none if empty.
+	Timeout string
+	// Community is the BGP community of BIRD blackhole routes, a standard
+	// "asn,value" or large "asn,value,value" community.
+	Community string
+	// Previous are the lists of the previous export, for formats adding the
+	// entries in place to remove those no longer listed.
+	Previous []List
+}
+
+// DefaultOptions are the options used when an option is not set.
+var DefaultOptions = Options{
+	Family:    "inet",
+	Table:     "filter",
+	ChunkSize: 1000,
+	Variable:  "$ip_list",
+	Values:    map[string]string{"": "1"},
+	Action:    "deny",
+	Scope:     "REGIONAL",
+	Community: "65535,666",
+}
+
+// Value returns the value of the entries of a list.
+func (o Options) Value(list string) string {
+	if value, ok := o.Values[list]; ok {
+		return value
+	}
+	if value, ok := o.Values[""]; ok {
+		return value
+	}
+
+	return DefaultOptions.Values[""]
+}
+
+// Format writes lists in a configuration format.
+type Format struct {
+	// Description is a short summary of the format.
+	Description string
+	// ContentType is the media type of the format, text/plain if empty.
+	ContentType string
+	// Write writes the lists to w.
+	Write func(w io.Writer, lists []List, opts Options) error
+}
+
+var formats = map[string]Format{}
+
+// Register adds a format, replacing any format of the same name.
+func Register(name string, format Format) {
+	formats[name] = format
+}
+
+// Get returns the format of a name.
+func Get(name string) (Format, error) {
+	format, ok := formats[name]
+	if !ok {
+		return Format{}, fmt.Errorf("unknown format %s, must be one of %s", name, strings.Join(Names(), ", "))
+	}
+
+	return format, nil
+}
+
+// Names returns the sorted names of all formats.
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// Write writes the lists in the named format, filling unset options with the
+// defaults.
+func Write(w io.Writer, name string, lists []List, opts Options) error {
+	format, err := Get(name)
+	if err != nil {
+		return err
+	}
+
+	if opts.Family == "" {
+		opts.Family = DefaultOptions.Family
+	}
+	if opts.Table == "" {
+		opts.Table = DefaultOptions.Table
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultOptions.ChunkSize
+	}
+	if opts.Variable == "" {
+		opts.Variable = DefaultOptions.Variable
+	}
+	if opts.Scope == "" {
+		opts.Scope = DefaultOptions.Scope
+	}
+	if opts.Community == "" {
+		opts.Community = DefaultOptions.Community
+	}
+	if opts.Action == "" {
+		opts.Action = DefaultOptions.Action
+	}
+	if opts.Action != "allow" && opts.Action != "deny" {
+		return fmt.Errorf("invalid action %s, must be allow or deny", opts.Action)
+	}
+
+	return format.Write(w, lists, opts)
+}
+
+var unsafe = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// Identifier returns a name safe to use as an identifier in most formats, ie:
+// letters, digits and underscores.
+func Identifier(name string) string {
+	return strings.Trim(unsafe.ReplaceAllString(name, "_"), "_")
+}
+
+// slug returns a name of letters, digits & hyphens, eg: for AWS, Juniper &
+// Cisco object names.
+func slug(name string) string {
+	return strings.ReplaceAll(Identifier(strings.ReplaceAll(name, "-", "_")), "_", "-")
+}
+
+// chunks splits the prefixes into slices of at most size prefixes.
+func chunks(prefixes []netip.Prefix, size int) [][]netip.Prefix {
+	chunks := [][]netip.Prefix{}
+	for size < len(prefixes) {
+		prefixes, chunks = prefixes[size:], append(chunks, prefixes[:size])
+	}
+	if len(prefixes) > 0 {
+		chunks = append(chunks, prefixes)
+	}
+
+	return chunks
+}
+
+func family(prefixes []netip.Prefix, ipv4 bool) []netip.Prefix {
+	filtered := []netip.Prefix{}
+	for _, p := range prefixes {
+		if p.Addr().Is4() == ipv4 {
+			filtered = append(filtered, p)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iplists/internal/cidr"
+	"net/netip"
+)
+
+// ipsetMaxName is the maximum length of an ipset name, including the "_tmp"
+// suffix of the replacement set.
+const ipsetMaxName = 31
+
+// ipsetMinElem is the default maxelem of ipset, the minimum used.
+const ipsetMinElem = 65536
+
+func init() {
+	Register("ipset", Format{
+		Description: "ipset restore file of hash:net sets",
+		Write:       writeIpset,
+	})
+	Register("ipset-swap", Format{
+		Description: "shell script replacing ipset hash:net sets atomically by swap",
+		Write:       writeIpsetSwap,
+	})
+}
+
+// ipset is a hash:net set of a single family.
+type ipset struct {
+	name     string
+	family   string
+	prefixes []netip.Prefix
+}
+
+// create returns the create command of the set under a name.
+func (s ipset) create(name string) string {
+	return fmt.Sprintf("create %s hash:net family %s maxelem %d", name, s.family, maxElem(len(s.prefixes)))
+}
+
+// ipsets returns the IPv4 & IPv6 sets of a list, eg: "googlebot_v4" &
+// "googlebot_v6".
+func ipsets(l List) []ipset {
+	name := Identifier(l.Name)
+	if len(name) > ipsetMaxName-len("_v4_tmp") {
+		name = name[:ipsetMaxName-len("_v4_tmp")]
+	}
+
+	sets := []ipset{}
+	for _, family := range l.Families() {
+		inet := "inet"
+		if family.IPv6 {
+			inet = "inet6"
+		}
+		sets = append(sets, ipset{name + "_" + family.Suffix, inet, family.Prefixes})
+	}
+
+	return sets
+}
+
+// writeIpset writes an "ipset restore" file creating a hash:net set per list &
+// family, eg: to load the sets at boot. An existing set is flushed and refilled
+// so the file can be restored again, though not atomically, see ipset-swap.
+func writeIpset(w io.Writer, lists []List, _ Options) error {
+	bw := bufio.NewWriter(w)
+
+	for _, l := range lists {
+		for _, set := range ipsets(l) {
+			fmt.Fprintln(bw, set.create(set.name)+" -exist")
+			fmt.Fprintf(bw, "flush %s\n", set.name)
+			writeIpsetAdds(bw, set.name, set.prefixes)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeIpsetSwap writes a shell script which fills a temporary set per list &
+// family with "ipset restore", then swaps it with the live set (created if
+// missing), so the live set is replaced atomically and can be referenced by
+// iptables rules throughout. The live set takes the maxelem of the temporary
+// set, which grows with the list.
+func writeIpsetSwap(w io.Writer, lists []List, _ Options) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "#!/bin/sh")
+	fmt.Fprintln(bw, "set -e")
+
+	for _, l := range lists {
+		for _, set := range ipsets(l) {
+			tmp := set.name + "_tmp"
+			fmt.Fprintln(bw)
+			fmt.Fprintf(bw, "ipset list -n %s >/dev/null 2>&1 || ipset %s\n", set.name, set.create(set.name))
+			fmt.Fprintf(bw, "ipset destroy %s >/dev/null 2>&1 || true\n", tmp)
+			fmt.Fprintln(bw, "ipset restore <<'EOF'")
+			fmt.Fprintln(bw, set.create(tmp))
+			writeIpsetAdds(bw, tmp, set.prefixes)
+			fmt.Fprintln(bw, "EOF")
+			fmt.Fprintf(bw, "ipset swap %s %s\n", tmp, set.name)
+			fmt.Fprintf(bw, "ipset destroy %s\n", tmp)
+		}
+	}
+
+	return bw.Flush()
+}
+
+func writeIpsetAdds(w io.Writer, name string, prefixes []netip.Prefix) {
+	for _, p := range prefixes {
+		fmt.Fprintf(w, "add %s %s\n", name, cidr.Format(p))
+	}
+}
+
+// maxElem returns the maxelem of a set of count elements, the next power of two
+// with room to grow by a quarter, and no less than the ipset default.
+func maxElem(count int) int {
+	n := ipsetMinElem
+	for n < count+count/4 {
+		n *= 2
+	}
+
+	return n
+}
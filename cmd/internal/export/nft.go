@@ -0,0 +1,82 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iplists/internal/cidr"
+	"net/netip"
+	"strings"
+)
+
+func init() {
+	Register("nft", Format{
+		Description: "nftables script of ipv4_addr & ipv6_addr interval sets",
+		Write:       writeNft,
+	})
+}
+
+// writeNft writes an nftables script declaring a set per list & family, eg:
+// "googlebot_v4" & "googlebot_v6", which are flushed and refilled. nft applies
+// a script as a single transaction so the sets are replaced atomically.
+// Uses the Family, Table & ChunkSize options.
+func writeNft(w io.Writer, lists []List, opts Options) error {
+	bw := bufio.NewWriter(w)
+	table := opts.Family + " " + opts.Table
+
+	fmt.Fprintln(bw, "#!/usr/sbin/nft -f")
+	fmt.Fprintln(bw)
+	fmt.Fprintf(bw, "table %s {\n", table)
+	for i, l := range lists {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+		for j, set := range nftSets(l) {
+			if j > 0 {
+				fmt.Fprintln(bw)
+			}
+			fmt.Fprintf(bw, "\tset %s {\n", set.name)
+			fmt.Fprintf(bw, "\t\ttype %s\n", set.addrType)
+			fmt.Fprintln(bw, "\t\tflags interval")
+			fmt.Fprintln(bw, "\t\tauto-merge")
+			fmt.Fprintln(bw, "\t}")
+		}
+	}
+	fmt.Fprintln(bw, "}")
+
+	for _, l := range lists {
+		for _, set := range nftSets(l) {
+			fmt.Fprintln(bw)
+			fmt.Fprintf(bw, "flush set %s %s\n", table, set.name)
+			for _, chunk := range chunks(set.prefixes, opts.ChunkSize) {
+				elements := make([]string, 0, len(chunk))
+				for _, p := range chunk {
+					elements = append(elements, cidr.Format(p))
+				}
+				fmt.Fprintf(bw, "add element %s %s { %s }\n", table, set.name, strings.Join(elements, ", "))
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+type nftSet struct {
+	name     string
+	addrType string
+	prefixes []netip.Prefix
+}
+
+// nftSets returns the IPv4 & IPv6 sets of a list.
+func nftSets(l List) []nftSet {
+	sets := []nftSet{}
+	for _, family := range l.Families() {
+		addrType := "ipv4_addr"
+		if family.IPv6 {
+			addrType = "ipv6_addr"
+		}
+		sets = append(sets, nftSet{Identifier(l.Name) + "_" + family.Suffix, addrType, family.Prefixes})
+	}
+
+	return sets
+}
@@ -0,0 +1,325 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iplists/internal/cidr"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// routerOSDuration matches a RouterOS duration, eg: "1d", "12h30m" or "1d00:00:00".
+var routerOSDuration = regexp.MustCompile(`^([0-9]+[wdhms]|[0-9]+:[0-9]{2}:[0-9]{2})+$`)
+
+func init() {
+	Register("mikrotik", Format{
+		Description: "MikroTik RouterOS script replacing firewall address-lists",
+		Write:       writeMikrotik,
+	})
+	Register("juniper", Format{
+		Description: "Juniper Junos policy-options prefix-lists, for load replace",
+		Write:       writeJuniper,
+	})
+	Register("cisco-prefix-list", Format{
+		Description: "Cisco IOS & NX-OS ip & ipv6 prefix-lists",
+		Write:       writeCiscoPrefixList,
+	})
+	Register("cisco-object-group", Format{
+		Description: "Cisco IOS network & v6-network object-groups",
+		Write:       writeCiscoObjectGroup,
+	})
+	Register("nxos-object-group", Format{
+		Description: "Cisco NX-OS ip & ipv6 address object-groups",
+		Write:       writeNxosObjectGroup,
+	})
+	Register("bird", Format{
+		Description: "BIRD 2 static blackhole routes tagged with a community, for RTBH",
+		Write:       writeBird,
+	})
+	Register("bird-set", Format{
+		Description: "BIRD 2 prefix set constants, for filters",
+		Write:       writeBirdSet,
+	})
+}
+
+// writeMikrotik writes a RouterOS script removing the entries of each
+// address-list and adding the list entries, IPv6 entries to the IPv6
+// address-list of the same name. Both families are always replaced so stale
+// entries of a family no longer listed are removed. Uses the Timeout option.
+func writeMikrotik(w io.Writer, lists []List, opts Options) error {
+	if opts.Timeout != "" && !routerOSDuration.MatchString(opts.Timeout) {
+		return fmt.Errorf("invalid timeout %s, must be a RouterOS duration, eg: 1d", opts.Timeout)
+	}
+
+	timeout := ""
+	if opts.Timeout != "" {
+		timeout = " timeout=" + opts.Timeout
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, l := range lists {
+		name := routerOSQuote(l.Name)
+		for _, family := range []struct {
+			menu     string
+			prefixes []netip.Prefix
+		}{
+			{"/ip firewall address-list", l.IPv4()},
+			{"/ipv6 firewall address-list", l.IPv6()},
+		} {
+			fmt.Fprintf(bw, "# %s\n", l.Name)
+			fmt.Fprintln(bw, family.menu)
+			fmt.Fprintf(bw, "remove [find where list=%s]\n", name)
+			for _, p := range family.prefixes {
+				fmt.Fprintf(bw, "add list=%s address=%s%s\n", name, cidr.Format(p), timeout)
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeJuniper writes a prefix-list per list, tagged to replace the existing
+// prefix-list with "load replace".
+func writeJuniper(w io.Writer, lists []List, _ Options) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "policy-options {")
+	for _, l := range lists {
+		fmt.Fprintln(bw, "    replace:")
+		fmt.Fprintf(bw, "    prefix-list %s {\n", slug(l.Name))
+		for _, p := range l.Prefixes {
+			fmt.Fprintf(bw, "        %s;\n", p)
+		}
+		fmt.Fprintln(bw, "    }")
+	}
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+// writeCiscoPrefixList writes configuration commands replacing an ip and an
+// ipv6 prefix-list per list in place, permitting each entry. A prefix-list in
+// use by a route-map must not be deleted, so each sequence number is deleted &
+// re-added, followed by an entry denying all which ends the list: the entries
+// of a longer previous list after it are never matched. An empty family is
+// replaced by the deny entry alone.
+func writeCiscoPrefixList(w io.Writer, lists []List, _ Options) error {
+	bw := bufio.NewWriter(w)
+
+	for _, l := range lists {
+		name := slug(l.Name)
+		for _, family := range l.Families() {
+			command, all := "ip prefix-list", "0.0.0.0/0 le 32"
+			if family.IPv6 {
+				command, all = "ipv6 prefix-list", "::/0 le 128"
+			}
+
+			fmt.Fprintf(bw, "! %s\n", l.Name)
+			for i, p := range family.Prefixes {
+				fmt.Fprintf(bw, "no %s %s seq %d\n", command, name, (i+1)*5)
+				fmt.Fprintf(bw, "%s %s seq %d permit %s\n", command, name, (i+1)*5, p)
+			}
+			seq := (len(family.Prefixes) + 1) * 5
+			fmt.Fprintf(bw, "no %s %s seq %d\n", command, name, seq)
+			fmt.Fprintf(bw, "%s %s seq %d deny %s\n", command, name, seq, all)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeCiscoObjectGroup writes configuration commands adding the entries to a
+// network object-group per list, and a v6-network object-group suffixed with
+// "-v6". Object-groups in use can't be deleted, so the entries of the Previous
+// option's list of the same name which are no longer listed are removed.
+// Without it, stale entries must be removed separately.
+func writeCiscoObjectGroup(w io.Writer, lists []List, opts Options) error {
+	previous := map[string]List{}
+	for _, l := range opts.Previous {
+		previous[l.Name] = l
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, l := range lists {
+		old := previous[l.Name].Families()
+		for i, family := range l.Families() {
+			listed := make(map[netip.Prefix]bool, len(family.Prefixes))
+			for _, p := range family.Prefixes {
+				listed[p] = true
+			}
+			stale := []netip.Prefix{}
+			for _, p := range old[i].Prefixes {
+				if !listed[p] {
+					stale = append(stale, p)
+				}
+			}
+			if len(family.Prefixes) == 0 && len(stale) == 0 {
+				continue
+			}
+
+			fmt.Fprintf(bw, "! %s\n", l.Name)
+			if family.IPv6 {
+				fmt.Fprintf(bw, "object-group v6-network %s-v6\n", slug(l.Name))
+			} else {
+				fmt.Fprintf(bw, "object-group network %s\n", slug(l.Name))
+			}
+			for _, p := range stale {
+				fmt.Fprintf(bw, " no %s\n", ciscoObjectEntry(p))
+			}
+			for _, p := range family.Prefixes {
+				fmt.Fprintf(bw, " %s\n", ciscoObjectEntry(p))
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// ciscoObjectEntry returns the object-group entry of a prefix, a host, an
+// IPv4 network & mask or an IPv6 prefix.
+func ciscoObjectEntry(p netip.Prefix) string {
+	switch {
+	case p.IsSingleIP():
+		return "host " + p.Addr().String()
+	case p.Addr().Is6():
+		return p.String()
+	}
+
+	mask := netip.AddrFrom4([4]byte{0xff, 0xff, 0xff, 0xff})
+	mask = netip.PrefixFrom(mask, p.Bits()).Masked().Addr()
+
+	return p.Addr().String() + " " + mask.String()
+}
+
+// writeNxosObjectGroup writes configuration commands adding the numbered
+// entries to an ip address object-group per list, and an ipv6 address
+// object-group suffixed with "-v6".
+func writeNxosObjectGroup(w io.Writer, lists []List, _ Options) error {
+	bw := bufio.NewWriter(w)
+
+	for _, l := range lists {
+		for _, family := range []struct {
+			command  string
+			name     string
+			prefixes []netip.Prefix
+		}{
+			{"object-group ip address", slug(l.Name), l.IPv4()},
+			{"object-group ipv6 address", slug(l.Name) + "-v6", l.IPv6()},
+		} {
+			if len(family.prefixes) == 0 {
+				continue
+			}
+
+			fmt.Fprintf(bw, "! %s\n", l.Name)
+			fmt.Fprintf(bw, "%s %s\n", family.command, family.name)
+			for i, p := range family.prefixes {
+				fmt.Fprintf(bw, "  %d %s\n", (i+1)*10, p)
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeBird writes a static protocol per list & family, eg:
+// "rtbh_tor_exit_nodes_v4", of blackhole routes tagged with the community to
+// announce to the upstream RTBH sessions. Uses the Community option.
+func writeBird(w io.Writer, lists []List, opts Options) error {
+	community, err := birdCommunity(opts.Community)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, l := range lists {
+		for _, family := range l.Families() {
+			channel := "ipv4"
+			if family.IPv6 {
+				channel = "ipv6"
+			}
+
+			fmt.Fprintf(bw, "# %s\n", l.Name)
+			fmt.Fprintf(bw, "protocol static rtbh_%s_%s {\n", Identifier(l.Name), family.Suffix)
+			fmt.Fprintf(bw, "\t%s {\n", channel)
+			fmt.Fprintln(bw, "\t\timport filter {")
+			fmt.Fprintf(bw, "\t\t\t%s;\n", community)
+			fmt.Fprintln(bw, "\t\t\taccept;")
+			fmt.Fprintln(bw, "\t\t};")
+			fmt.Fprintln(bw, "\t};")
+			for _, p := range family.Prefixes {
+				fmt.Fprintf(bw, "\troute %s blackhole;\n", p)
+			}
+			fmt.Fprintln(bw, "}")
+			fmt.Fprintln(bw)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeBirdSet writes a prefix set constant per list & family, eg:
+// "tor_exit_nodes_v4", for filters such as "if net ~ tor_exit_nodes_v4".
+func writeBirdSet(w io.Writer, lists []List, _ Options) error {
+	bw := bufio.NewWriter(w)
+
+	for _, l := range lists {
+		for _, family := range l.Families() {
+			// BIRD has no empty set
+			if len(family.Prefixes) == 0 {
+				continue
+			}
+
+			name := Identifier(l.Name) + "_" + family.Suffix
+			if unicode.IsDigit(rune(name[0])) {
+				name = "list_" + name
+			}
+
+			fmt.Fprintf(bw, "# %s\n", l.Name)
+			fmt.Fprintf(bw, "define %s = [\n", name)
+			for i, p := range family.Prefixes {
+				separator := ","
+				if i == len(family.Prefixes)-1 {
+					separator = ""
+				}
+				fmt.Fprintf(bw, "\t%s%s\n", p, separator)
+			}
+			fmt.Fprintln(bw, "];")
+			fmt.Fprintln(bw)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// birdCommunity returns the BIRD statement adding a standard or large
+// community.
+func birdCommunity(community string) (string, error) {
+	parts := strings.Split(community, ",")
+	bits := 16
+	attribute := "bgp_community"
+	if len(parts) == 3 {
+		bits = 32
+		attribute = "bgp_large_community"
+	} else if len(parts) != 2 {
+		return "", fmt.Errorf("invalid community %s, must be asn,value or asn,value,value", community)
+	}
+
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if _, err := strconv.ParseUint(part, 10, bits); err != nil {
+			return "", fmt.Errorf("invalid community %s, must be asn,value or asn,value,value", community)
+		}
+		parts[i] = part
+	}
+
+	return fmt.Sprintf("%s.add((%s))", attribute, strings.Join(parts, ", ")), nil
+}
+
+// routerOSQuote quotes a value for a RouterOS script.
+func routerOSQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(value) + `"`
+}
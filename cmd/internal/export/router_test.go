@@ -0,0 +1,63 @@
+package export
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestWriteCiscoObjectGroup(t *testing.T) {
+	list := func(name string, entries ...string) List {
+		l := List{Name: name}
+		for _, entry := range entries {
+			l.Prefixes = append(l.Prefixes, netip.MustParsePrefix(entry))
+		}
+		return l
+	}
+
+	for _, tt := range []struct {
+		name     string
+		lists    []List
+		previous []List
+		want     string
+	}{
+		{
+			"added",
+			[]List{list("tor exit", "1.1.1.1/32", "8.8.8.0/24", "2606:4700::1/128", "2606:4700::/32")},
+			nil,
+			`! tor exit
+object-group network tor-exit
+ host 1.1.1.1
+ 8.8.8.0 255.255.255.0
+! tor exit
+object-group v6-network tor-exit-v6
+ host 2606:4700::1
+ 2606:4700::/32
+`,
+		},
+		{
+			"stale entries removed",
+			[]List{list("tor exit", "1.1.1.1/32", "8.8.4.0/24")},
+			[]List{list("tor exit", "1.1.1.1/32", "8.8.8.0/24", "2606:4700::1/128"), list("other", "9.9.9.9/32")},
+			`! tor exit
+object-group network tor-exit
+ no 8.8.8.0 255.255.255.0
+ host 1.1.1.1
+ 8.8.4.0 255.255.255.0
+! tor exit
+object-group v6-network tor-exit-v6
+ no host 2606:4700::1
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := Write(&b, "cisco-object-group", tt.lists, Options{Previous: tt.previous}); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Fatalf("Write() =\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
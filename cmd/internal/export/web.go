@@ -0,0 +1,149 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iplists/internal/cidr"
+	"strings"
+)
+
+// apacheChunkSize is the number of IPs per Require directive, keeping lines
+// well within the Apache configuration line limit.
+const apacheChunkSize = 50
+
+func init() {
+	Register("nginx-geo", Format{
+		Description: "nginx geo block setting a variable for each list",
+		Write:       writeNginxGeo,
+	})
+	Register("nginx-access", Format{
+		Description: "nginx allow or deny directives, for an include",
+		Write:       writeNginxAccess,
+	})
+	Register("apache", Format{
+		Description: "Apache 2.4 Require ip or Require not ip block",
+		Write:       writeApache,
+	})
+	Register("haproxy-acl", Format{
+		Description: "HAProxy ACL file, eg: acl listed src -f <file>",
+		Write:       writeHaproxyACL,
+	})
+	Register("haproxy-map", Format{
+		Description: "HAProxy map file of the value of each list, eg: map_ip(<file>)",
+		Write:       writeHaproxyMap,
+	})
+}
+
+// writeNginxGeo writes a geo block setting the variable to the value of the
+// list containing the client IP, or 0. Uses the Variable & Values options.
+func writeNginxGeo(w io.Writer, lists []List, opts Options) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "geo %s {\n", opts.Variable)
+	fmt.Fprintln(bw, "\tdefault 0;")
+	for _, l := range lists {
+		fmt.Fprintln(bw)
+		fmt.Fprintf(bw, "\t# %s\n", l.Name)
+		value := nginxQuote(opts.Value(l.Name))
+		for _, p := range l.Prefixes {
+			fmt.Fprintf(bw, "\t%s %s;\n", cidr.Format(p), value)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+// writeNginxAccess writes an allow or deny directive per entry. An allow list
+// ends with "deny all". Uses the Action option.
+func writeNginxAccess(w io.Writer, lists []List, opts Options) error {
+	bw := bufio.NewWriter(w)
+
+	for _, l := range lists {
+		fmt.Fprintf(bw, "# %s\n", l.Name)
+		for _, p := range l.Prefixes {
+			fmt.Fprintf(bw, "%s %s;\n", opts.Action, cidr.Format(p))
+		}
+	}
+	if opts.Action == "allow" {
+		fmt.Fprintln(bw, "deny all;")
+	}
+
+	return bw.Flush()
+}
+
+// writeApache writes a RequireAny block of "Require ip" directives to allow, or
+// a RequireAll block of "Require not ip" directives to deny. Uses the Action
+// option.
+func writeApache(w io.Writer, lists []List, opts Options) error {
+	bw := bufio.NewWriter(w)
+
+	require := "Require ip"
+	if opts.Action == "allow" {
+		fmt.Fprintln(bw, "<RequireAny>")
+	} else {
+		require = "Require not ip"
+		fmt.Fprintln(bw, "<RequireAll>")
+		fmt.Fprintln(bw, "    Require all granted")
+	}
+
+	for _, l := range lists {
+		fmt.Fprintf(bw, "    # %s\n", l.Name)
+		for _, chunk := range chunks(l.Prefixes, apacheChunkSize) {
+			entries := make([]string, 0, len(chunk))
+			for _, p := range chunk {
+				entries = append(entries, cidr.Format(p))
+			}
+			fmt.Fprintf(bw, "    %s %s\n", require, strings.Join(entries, " "))
+		}
+	}
+
+	if opts.Action == "allow" {
+		fmt.Fprintln(bw, "</RequireAny>")
+	} else {
+		fmt.Fprintln(bw, "</RequireAll>")
+	}
+
+	return bw.Flush()
+}
+
+// writeHaproxyACL writes an entry per line, for the src ACL.
+func writeHaproxyACL(w io.Writer, lists []List, _ Options) error {
+	bw := bufio.NewWriter(w)
+
+	for _, l := range lists {
+		fmt.Fprintf(bw, "# %s\n", l.Name)
+		for _, p := range l.Prefixes {
+			fmt.Fprintln(bw, cidr.Format(p))
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeHaproxyMap writes an entry and the value of its list per line, for the
+// map_ip converter. Uses the Values option.
+func writeHaproxyMap(w io.Writer, lists []List, opts Options) error {
+	bw := bufio.NewWriter(w)
+
+	for _, l := range lists {
+		fmt.Fprintf(bw, "# %s\n", l.Name)
+		value := opts.Value(l.Name)
+		for _, p := range l.Prefixes {
+			fmt.Fprintf(bw, "%s %s\n", cidr.Format(p), value)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// nginxQuote quotes a value if it is empty or contains characters with special
+// meaning in the nginx configuration syntax.
+func nginxQuote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n;{}\"'#$\\") {
+		return value
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
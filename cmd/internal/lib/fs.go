@@ -2,6 +2,8 @@ package lib
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 )
@@ -15,19 +17,59 @@ func GetContents(file string) ([]string, error) {
 	}
 	defer func() { _ = f.Close() }()
 
-	// Read the file line by line
+	return ReadLines(f)
+}
+
+// ReadLines returns the non-empty, trimmed lines from a reader.
+func ReadLines(r io.Reader) ([]string, error) {
 	var contents []string
-	scanner := bufio.NewScanner(f)
+	err := EachLine(r, func(line string) error {
+		contents = append(contents, line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return contents, nil
+}
+
+// EachLine calls fn for each non-empty, trimmed line from a reader without
+// loading the whole input into memory.
+func EachLine(r io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
-		if line != "" {
-			contents = append(contents, line)
+		if line == "" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	return scanner.Err()
+}
+
+// WriteLines creates or truncates a file and writes the lines to it.
+func WriteLines(file string, lines []string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
 	}
 
-	return contents, nil
+	w := bufio.NewWriter(f)
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
 }
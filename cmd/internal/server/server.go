@@ -0,0 +1,298 @@
+// Package server provides the HTTP lookup and list-serving daemon.
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"iplists/cmd/internal/export"
+	"iplists/internal/cidr"
+	"iplists/pkg/lists"
+	"iplists/pkg/realip"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server serves lookups against, and the contents of, a directory of lists.
+// The lists are swapped atomically on Reload so requests are never blocked.
+type Server struct {
+	dir      string
+	state    atomic.Pointer[state]
+	clientIP func(r *http.Request) (netip.Addr, error)
+}
+
+// state is an immutable snapshot of the lists directory
+type state struct {
+	set         *lists.Set
+	files       map[string]listFile
+	fingerprint string
+	// exports caches the rendered exports of the lists, by "name/format"
+	exports sync.Map
+}
+
+// listFile is a single list as read from disk
+type listFile struct {
+	content []byte
+	modTime time.Time
+	etag    string
+}
+
+// New returns a Server for a directory of lists, loading them immediately.
+func New(dir string) (*Server, error) {
+	s := &Server{dir: dir, clientIP: remoteAddr}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Reload reads the lists directory again, replacing the served lists.
+func (s *Server) Reload() error {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.txt"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no lists found in %s", s.dir)
+	}
+
+	// taken before reading so a list modified while being read is reloaded by
+	// the next Watch poll
+	fingerprint, err := s.fingerprint()
+	if err != nil {
+		return err
+	}
+
+	next := &state{set: lists.New(), files: map[string]listFile{}, fingerprint: fingerprint}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return err
+		}
+
+		name := lists.Name(file)
+		if err := next.set.Add(name, bytes.NewReader(content)); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		sum := sha256.Sum256(content)
+		next.files[name] = listFile{
+			content: content,
+			modTime: info.ModTime().UTC().Truncate(time.Second),
+			etag:    hex.EncodeToString(sum[:8]),
+		}
+	}
+
+	s.state.Store(next)
+
+	return nil
+}
+
+// fingerprint returns a summary of the names, sizes and modification times of
+// the lists, which changes whenever a list is added, removed or modified.
+func (s *Server) fingerprint() (string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.txt"))
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return b.String(), nil
+}
+
+// TrustProxies resolves the client IP of "GET /lookup" through the forwarded
+// headers of trusted proxies, rather than using the peer address.
+func (s *Server) TrustProxies(resolver *realip.Resolver) {
+	s.clientIP = resolver.ClientIP
+}
+
+// Watch polls the lists directory every interval, reloading when a list is
+// added, removed or modified, until done is closed.
+func (s *Server) Watch(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			fingerprint, err := s.fingerprint()
+			if err != nil || fingerprint == s.state.Load().fingerprint {
+				continue
+			}
+
+			if err := s.Reload(); err != nil {
+				log.Printf("Error reloading lists: %v", err)
+				continue
+			}
+			log.Printf("Reloaded %d lists after a change in %s", len(s.state.Load().files), s.dir)
+		}
+	}
+}
+
+// Handler returns the HTTP handler serving the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /lookup", s.lookup)
+	mux.HandleFunc("GET /lookup/{ip...}", s.lookup)
+	mux.HandleFunc("GET /lists", s.index)
+	mux.HandleFunc("GET /lists/{name}", s.list)
+
+	return mux
+}
+
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status": "ok",
+		"lists":  len(s.state.Load().files),
+	})
+}
+
+// lookup reports the lists containing an IP, or overlapping a CIDR, defaulting
+// to the client IP of the request.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) {
+	query := r.PathValue("ip")
+	if query == "" {
+		addr, err := s.clientIP(r)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		query = addr.String()
+	}
+
+	p, err := cidr.Parse(query)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	matches := s.state.Load().set.Matches(p)
+	names := []string{}
+	for _, m := range matches {
+		if !slices.Contains(names, m.List) {
+			names = append(names, m.List)
+		}
+	}
+	slices.Sort(names)
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"query":   query,
+		"lists":   names,
+		"matches": matches,
+	})
+}
+
+func (s *Server) index(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.state.Load().set.Names())
+}
+
+// list serves the contents of a list, as-is or in an export format, with
+// conditional request support.
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(r.PathValue("name"), ".txt")
+	// a single snapshot so the contents always match the ETag
+	st := s.state.Load()
+	file, ok := st.files[name]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "list not found: " + name})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "txt"
+	}
+
+	var content []byte
+	switch format {
+	case "txt":
+		content = file.content
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	case "json":
+		entries := []string{}
+		for _, line := range strings.Split(string(file.content), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				entries = append(entries, line)
+			}
+		}
+		content, _ = json.Marshal(entries)
+		w.Header().Set("Content-Type", "application/json")
+	default:
+		exporter, err := export.Get(format)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if content, err = st.export(name, format); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		contentType := exporter.ContentType
+		if contentType == "" {
+			contentType = "text/plain; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	// the representation differs per format so each has its own ETag
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%s"`, file.etag, format))
+	http.ServeContent(w, r, "", file.modTime, bytes.NewReader(content))
+}
+
+// export returns a list rendered in an export format, rendering it once per
+// state as the prefixes of a list are aggregated from the trie.
+func (st *state) export(name, format string) ([]byte, error) {
+	key := name + "/" + format
+	if content, ok := st.exports.Load(key); ok {
+		return content.([]byte), nil
+	}
+
+	var b bytes.Buffer
+	l := export.List{Name: name, Prefixes: st.set.Prefixes(name)}
+	if err := export.Write(&b, format, []export.List{l}, export.Options{}); err != nil {
+		return nil, err
+	}
+	st.exports.Store(key, b.Bytes())
+
+	return b.Bytes(), nil
+}
+
+// remoteAddr returns the IP of the directly connected peer.
+func remoteAddr(r *http.Request) (netip.Addr, error) {
+	return realip.ParseHost(r.RemoteAddr)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
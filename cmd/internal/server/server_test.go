@@ -0,0 +1,189 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newServer returns a Server of a directory with a list of the entries.
+func newServer(t *testing.T, entries ...string) (*Server, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeList(t, dir, "bad", entries...)
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, dir
+}
+
+func writeList(t *testing.T, dir, name string, entries ...string) {
+	t.Helper()
+
+	content := strings.Join(entries, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, name+".txt"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// get sends a GET request to the server, with an If-None-Match header if etag
+// is set.
+func get(s *Server, target, etag string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	r.RemoteAddr = "1.1.1.1:1234"
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+
+	return w
+}
+
+func TestList(t *testing.T) {
+	s, _ := newServer(t, "1.1.1.1", "8.8.8.0/24")
+
+	for _, tt := range []struct {
+		target      string
+		wantStatus  int
+		contentType string
+		contains    string
+	}{
+		{"/lists/bad", 200, "text/plain; charset=utf-8", "8.8.8.0/24\n"},
+		{"/lists/bad.txt", 200, "text/plain; charset=utf-8", "8.8.8.0/24\n"},
+		{"/lists/bad?format=json", 200, "application/json", `["1.1.1.1","8.8.8.0/24"]`},
+		{"/lists/bad?format=nft", 200, "text/plain; charset=utf-8", "8.8.8.0/24"},
+		{"/lists/bad?format=aws-waf", 200, "application/json", `"8.8.8.0/24"`},
+		{"/lists/bad?format=bogus", 400, "application/json", "unknown format bogus"},
+		{"/lists/missing", 404, "application/json", "list not found: missing"},
+	} {
+		t.Run(tt.target, func(t *testing.T) {
+			w := get(s, tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %s, want %s", got, tt.contentType)
+			}
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("body = %s, want %s", w.Body, tt.contains)
+			}
+		})
+	}
+}
+
+func TestListETag(t *testing.T) {
+	s, _ := newServer(t, "1.1.1.1", "8.8.8.0/24")
+
+	etags := map[string]string{}
+	for _, format := range []string{"txt", "json", "nft", "aws-waf"} {
+		w := get(s, "/lists/bad?format="+format, "")
+		etag := w.Header().Get("ETag")
+		if w.Code != 200 || !strings.HasSuffix(etag, "-"+format+`"`) {
+			t.Fatalf("%s: status = %d, ETag = %s, want 200 & an ETag of the format", format, w.Code, etag)
+		}
+		etags[format] = etag
+
+		if w := get(s, "/lists/bad?format="+format, etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("%s: If-None-Match status = %d, want 304", format, w.Code)
+		}
+	}
+
+	// the ETag of another format is a different representation
+	if w := get(s, "/lists/bad?format=nft", etags["txt"]); w.Code != 200 {
+		t.Errorf("If-None-Match of another format status = %d, want 200", w.Code)
+	}
+	if w := get(s, "/lists/bad", etags["txt"]); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match of the default format status = %d, want 304", w.Code)
+	}
+	if w := get(s, "/lists/bad?format=txt", `"stale-txt"`); w.Code != 200 {
+		t.Errorf("If-None-Match of a stale ETag status = %d, want 200", w.Code)
+	}
+}
+
+func TestReload(t *testing.T) {
+	s, dir := newServer(t, "1.1.1.1")
+
+	before := get(s, "/lists/bad?format=nft", "")
+	if !strings.Contains(before.Body.String(), "1.1.1.1") {
+		t.Fatalf("body = %s, want 1.1.1.1", before.Body)
+	}
+
+	writeList(t, dir, "bad", "8.8.8.8")
+	writeList(t, dir, "tor", "9.9.9.9")
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cached export of the previous lists is not served
+	after := get(s, "/lists/bad?format=nft", before.Header().Get("ETag"))
+	if after.Code != 200 || !strings.Contains(after.Body.String(), "8.8.8.8") || strings.Contains(after.Body.String(), "1.1.1.1") {
+		t.Fatalf("reloaded status = %d, body = %s, want 200 & 8.8.8.8", after.Code, after.Body)
+	}
+	if after.Header().Get("ETag") == before.Header().Get("ETag") {
+		t.Error("ETag unchanged after the list changed")
+	}
+
+	var names []string
+	if err := json.Unmarshal(get(s, "/lists", "").Body.Bytes(), &names); err != nil || !slices.Equal(names, []string{"bad", "tor"}) {
+		t.Errorf("lists = %v %v, want [bad tor]", names, err)
+	}
+
+	// a failed reload keeps the current lists
+	for _, name := range []string{"bad", "tor"} {
+		if err := os.Remove(filepath.Join(dir, name+".txt")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Reload(); err == nil {
+		t.Fatal("Reload() of an empty directory returned no error")
+	}
+	if w := get(s, "/lists/bad", ""); w.Code != 200 || w.Body.String() != "8.8.8.8\n" {
+		t.Errorf("status after a failed reload = %d, body = %s, want 200 & 8.8.8.8", w.Code, w.Body)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	s, _ := newServer(t, "1.1.1.0/24")
+
+	for _, tt := range []struct {
+		target     string
+		wantStatus int
+		query      string
+		lists      []string
+	}{
+		{"/lookup", 200, "1.1.1.1", []string{"bad"}},
+		{"/lookup/8.8.8.8", 200, "8.8.8.8", []string{}},
+		{"/lookup/1.1.0.0/16", 200, "1.1.0.0/16", []string{"bad"}},
+		{"/lookup/bogus", 400, "", nil},
+	} {
+		t.Run(tt.target, func(t *testing.T) {
+			w := get(s, tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			var got struct {
+				Query string
+				Lists []string
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Query != tt.query || !slices.Equal(got.Lists, tt.lists) {
+				t.Errorf("lookup = %+v, want %s %v", got, tt.query, tt.lists)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"iplists/internal/cidr"
+	"net/netip"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var invertWithin string
+
+// invertCmd represents the invert command
+var invertCmd = &cobra.Command{
+	Use:   "invert <list>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Invert a list of IPs or CIDRs",
+	Long: `Computes the complement of a list over the public IPv4 & IPv6 address space,
+outputting the minimum IPs & subnets not covered by the list.
+
+Reserved ranges (private, loopback etc) are never included in the output.
+The complement can be limited to a specific CIDR with --within.`,
+	Run: func(_ *cobra.Command, args []string) {
+		exclude, err := cidr.LoadFiles(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+		exclude = append(exclude, cidr.ReservedPrefixes...)
+
+		scopes := []netip.Prefix{cidr.IPv4All, cidr.IPv6All}
+		if invertWithin != "" {
+			p, err := cidr.Parse(invertWithin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error parsing --within: %v\n", err)
+				os.Exit(1)
+			}
+			scopes = []netip.Prefix{p}
+		}
+
+		for _, scope := range scopes {
+			for _, p := range cidr.Complement(scope, exclude) {
+				fmt.Println(cidr.Format(p))
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(invertCmd)
+
+	invertCmd.Flags().StringVar(&invertWithin, "within", "", "Limit the complement to a CIDR")
+}
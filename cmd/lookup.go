@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iplists/cmd/internal/lib"
+	"iplists/internal/cidr"
+	"iplists/pkg/lists"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	lookupListsDir string
+	lookupFormat   string
+)
+
+// lookupResult is a single query and the list entries matching it
+type lookupResult struct {
+	Query   string        `json:"query"`
+	Matches []lookupMatch `json:"matches"`
+}
+
+type lookupMatch struct {
+	List         string `json:"list"`
+	Entry        string `json:"entry"`
+	PrefixLength int    `json:"prefix_length"`
+}
+
+// lookupCmd represents the lookup command
+var lookupCmd = &cobra.Command{
+	Use:   "lookup <ip|cidr|-> [<ip|cidr>...]",
+	Short: "Report which lists contain IPs or CIDRs",
+	Long: `Report every list containing (or overlapping) the given IPs or CIDRs, with
+the matching list entry and its prefix length.
+
+Queries are read from stdin, one per line, when none are given or for "-".
+Output is tab separated (query, list, entry, prefix length) with a row for each
+match, or a single row with empty columns when nothing matches. Use --format
+json for one JSON object per query and line.`,
+	Run: func(_ *cobra.Command, args []string) {
+		if lookupFormat != "tsv" && lookupFormat != "json" {
+			fmt.Fprintln(os.Stderr, "--format must be one of tsv or json")
+			os.Exit(1)
+		}
+
+		set, err := lists.LoadDir(lookupListsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading lists from %s: %v\n", lookupListsDir, err)
+			os.Exit(1)
+		}
+		if len(set.Names()) == 0 {
+			fmt.Fprintf(os.Stderr, "No lists found in %s\n", lookupListsDir)
+			os.Exit(1)
+		}
+
+		w := bufio.NewWriter(os.Stdout)
+		defer func() { _ = w.Flush() }()
+
+		if lookupFormat == "tsv" {
+			fmt.Fprintln(w, "query\tlist\tentry\tprefix_length")
+		}
+
+		invalid := 0
+		lookup := func(query string) error {
+			p, err := cidr.Parse(query)
+			if err != nil {
+				invalid++
+				fmt.Fprintln(os.Stderr, err)
+				return nil
+			}
+
+			result := lookupResult{Query: query, Matches: []lookupMatch{}}
+			for _, m := range set.Matches(p) {
+				result.Matches = append(result.Matches, lookupMatch{
+					List:         m.List,
+					Entry:        cidr.Format(m.Prefix),
+					PrefixLength: m.Prefix.Bits(),
+				})
+			}
+
+			return writeLookupResult(w, result)
+		}
+
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+
+		for _, arg := range args {
+			if arg != "-" {
+				err = lookup(arg)
+			} else {
+				err = lib.EachLine(os.Stdin, lookup)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if invalid > 0 {
+			_ = w.Flush()
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lookupCmd)
+
+	lookupCmd.Flags().StringVar(&lookupListsDir, "lists-dir", "lists", "Directory of lists to search")
+	lookupCmd.Flags().StringVarP(&lookupFormat, "format", "f", "tsv", "Output format (tsv or json)")
+}
+
+// writeLookupResult writes a lookup result in the selected format.
+func writeLookupResult(w io.Writer, result lookupResult) error {
+	if lookupFormat == "json" {
+		return json.NewEncoder(w).Encode(result)
+	}
+
+	if len(result.Matches) == 0 {
+		_, err := fmt.Fprintf(w, "%s\t\t\t\n", result.Query)
+		return err
+	}
+
+	for _, m := range result.Matches {
+		_, err := fmt.Fprintln(w, strings.Join([]string{result.Query, m.List, m.Entry, fmt.Sprint(m.PrefixLength)}, "\t"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -3,9 +3,9 @@ package cmd
 import (
 	"fmt"
 	"iplists/cmd/internal/lib"
-	"net"
+	"iplists/internal/cidr"
+	"iplists/pkg/iptrie"
 	"os"
-	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -26,82 +26,28 @@ which are present in "with_list_list".`,
 			return
 		}
 
-		fromList, err := lib.GetContents(args[1])
+		trie, err := pruneTrie(cmd, args[1])
 		if err != nil {
 			fmt.Fprintf(cmd.ErrOrStderr(), "Error reading destination file %s: %v\n", args[1], err)
 			os.Exit(1)
 			return
 		}
 
-		// exact matches
-		fromListExact := make(map[string]bool)
-		// map prefix to a slice of *net.IPNet for fast lookup
-		fromListCIDR := make(map[string][]*net.IPNet)
-
-		for _, entry := range fromList {
-			if entry == "" {
-				continue
-			}
-			fromListExact[entry] = true
-
-			if strings.Contains(entry, "/") {
-				// if the entry contains a '/', treat it as a CIDR
-				if _, cidr, err := net.ParseCIDR(entry); err == nil {
-					prefix := cidrPrefix(entry)
-					arr, ok := fromListCIDR[prefix]
-					if !ok {
-						arr = []*net.IPNet{}
-					}
-					arr = append(arr, cidr)
-					fromListCIDR[prefix] = arr
-				} else {
-					fmt.Fprintf(cmd.ErrOrStderr(), "Invalid CIDR in this_list: %s\n", entry)
-				}
-				continue
-			}
-		}
-
 		newList := []string{}
 		removed := 0
 
 		for _, entry := range dst {
-			if entry == "" {
+			// CIDRs are only removed when wholly contained
+			if p, err := cidr.Parse(entry); err == nil && trie.Covers(p) {
+				removed++
 				continue
 			}
 
-			toScan := entry
-
-			if strings.Contains(toScan, "/") {
-				_, ok := fromListExact[toScan]
-				if ok {
-					removed++
-					continue
-				}
-
-				toScan = strings.Split(entry, "/")[0]
-			}
-
-			prefix := cidrPrefix(toScan)
-			ip := net.ParseIP(toScan)
-
-			found := false
-
-			arr, ok := fromListCIDR[prefix]
-			if ok {
-				for _, cidr := range arr {
-					if cidr.Contains(ip) {
-						removed++
-						found = true
-						continue
-					}
-				}
-			}
-
-			if !found {
-				newList = append(newList, entry)
-			}
+			newList = append(newList, entry)
 		}
 
+		cidr.SortStrings(newList)
+
 		f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error opening file %s: %v\n", args[0], err)
@@ -111,7 +57,7 @@ which are present in "with_list_list".`,
 
 		for _, entry := range newList {
 			if _, err := fmt.Fprintln(f, entry); err != nil {
-				fmt.Fprintf(os.Stderr, "Error writing to output file %s: %v\n", args[1], err)
+				fmt.Fprintf(os.Stderr, "Error writing to output file %s: %v\n", args[0], err)
 				os.Exit(1)
 			}
 		}
@@ -135,15 +81,24 @@ func init() {
 	// pruneCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-// CIDRPrefix will return the first two parts of an IP, used for
-func cidrPrefix(ip string) string {
-	if strings.Contains(ip, ":") {
-		//ipv6
-		parts := strings.Split(ip, ":")
-		return fmt.Sprintf("%s:%s", parts[0], parts[1])
+// pruneTrie loads a list into a trie for fast lookups.
+func pruneTrie(cmd *cobra.Command, file string) (*iptrie.Trie[struct{}], error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
 	}
+	defer func() { _ = f.Close() }()
+
+	trie := iptrie.New[struct{}]()
+	err = lib.EachLine(f, func(entry string) error {
+		p, err := cidr.Parse(entry)
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Invalid IP or CIDR in %s: %s\n", file, entry)
+			return nil
+		}
+		trie.Insert(p, struct{}{})
+		return nil
+	})
 
-	// ipv4
-	parts := strings.Split(ip, ".")
-	return fmt.Sprintf("%s.%s", parts[0], parts[1])
+	return trie, err
 }
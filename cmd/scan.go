@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"iplists/cmd/internal/accesslog"
+	"iplists/cmd/internal/lib"
+	"iplists/pkg/bots"
+	"iplists/pkg/lists"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	scanListsDir string
+	scanFormat   string
+	scanLogType  string
+	scanIPField  string
+	scanUAField  string
+	scanTop      int
+)
+
+// scanCategories are the categories of lists in the order they are reported
+var scanCategories = []string{"good-bot", "abuse", "vpn", "proxy", "tor", "other", "unlisted"}
+
+// scanOffending are the categories of lists whose IPs are ranked as offenders
+var scanOffending = []string{"abuse", "vpn", "proxy", "tor"}
+
+type scanReport struct {
+	Requests   int                 `json:"requests"`
+	IPs        int                 `json:"ips"`
+	Unparsed   int                 `json:"unparsed"`
+	Categories map[string]int      `json:"categories"`
+	Lists      []scanListHits      `json:"lists"`
+	Offenders  []scanOffendingHits `json:"offenders"`
+}
+
+type scanListHits struct {
+	List     string `json:"list"`
+	Category string `json:"category"`
+	Requests int    `json:"requests"`
+	IPs      int    `json:"ips"`
+}
+
+type scanOffendingHits struct {
+	IP       netip.Addr `json:"ip"`
+	Requests int        `json:"requests"`
+	Lists    []string   `json:"lists"`
+}
+
+// scanCmd represents the scan command
+var scanCmd = &cobra.Command{
+	Use:   "scan <logfile|-> [<logfile>...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Report list hits in access logs",
+	Long: `Scan access logs and report the requests from IPs in each list, the requests
+by category of list (good bots, abuse, VPN, proxy & Tor), and the top offending
+IPs (those in abuse, VPN, proxy or Tor lists).
+
+Logs may be in the nginx/Apache combined (or common) log format, JSON lines or
+plain text, where the first IP of each line is used. The format is detected for
+each line unless --log-format is set. Use --ip-field and --ua-field for the
+fields of JSON lines, which may be nested with dots, eg: "client.ip".
+Logs ending in .gz are decompressed, use "-" to read from stdin.`,
+	Run: func(_ *cobra.Command, args []string) {
+		if scanFormat != "text" && scanFormat != "json" {
+			fmt.Fprintln(os.Stderr, "--format must be one of text or json")
+			os.Exit(1)
+		}
+
+		parser, err := accesslog.NewParser(accesslog.Format(scanLogType), scanIPField, scanUAField)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		set, err := lists.LoadDir(scanListsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading lists from %s: %v\n", scanListsDir, err)
+			os.Exit(1)
+		}
+
+		requests := map[netip.Addr]int{}
+		unparsed := 0
+		for _, file := range args {
+			skipped, err := scanLog(parser, file, func(e accesslog.Entry) {
+				requests[e.IP]++
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", inputName(file), err)
+				os.Exit(1)
+			}
+			unparsed += skipped
+		}
+
+		report := scanReport{
+			IPs:        len(requests),
+			Unparsed:   unparsed,
+			Categories: map[string]int{},
+			Lists:      []scanListHits{},
+			Offenders:  []scanOffendingHits{},
+		}
+		for _, category := range scanCategories {
+			report.Categories[category] = 0
+		}
+
+		hits := map[string]*scanListHits{}
+		for addr, count := range requests {
+			report.Requests += count
+
+			names := set.Lookup(addr)
+			if len(names) == 0 {
+				report.Categories["unlisted"] += count
+				continue
+			}
+
+			categories := []string{}
+			for _, name := range names {
+				category := listCategory(name)
+				if !slices.Contains(categories, category) {
+					categories = append(categories, category)
+					report.Categories[category] += count
+				}
+
+				if hits[name] == nil {
+					hits[name] = &scanListHits{List: name, Category: category}
+				}
+				hits[name].Requests += count
+				hits[name].IPs++
+			}
+
+			if slices.ContainsFunc(categories, func(c string) bool { return slices.Contains(scanOffending, c) }) {
+				report.Offenders = append(report.Offenders, scanOffendingHits{IP: addr, Requests: count, Lists: names})
+			}
+		}
+
+		for _, h := range hits {
+			report.Lists = append(report.Lists, *h)
+		}
+		slices.SortFunc(report.Lists, func(a, b scanListHits) int {
+			if a.Requests != b.Requests {
+				return b.Requests - a.Requests
+			}
+			return strings.Compare(a.List, b.List)
+		})
+		slices.SortFunc(report.Offenders, func(a, b scanOffendingHits) int {
+			if a.Requests != b.Requests {
+				return b.Requests - a.Requests
+			}
+			return a.IP.Compare(b.IP)
+		})
+		if scanTop > 0 && len(report.Offenders) > scanTop {
+			report.Offenders = report.Offenders[:scanTop]
+		}
+
+		if scanFormat == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(report); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		writeScanReport(report)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+
+	scanCmd.Flags().StringVar(&scanListsDir, "lists-dir", "lists", "Directory of lists")
+	scanCmd.Flags().StringVarP(&scanFormat, "format", "f", "text", "Report format (text or json)")
+	scanCmd.Flags().StringVar(&scanLogType, "log-format", "auto", "Log format (auto, combined, json or plain)")
+	scanCmd.Flags().StringVar(&scanIPField, "ip-field", "remote_addr", "Client IP field of JSON logs")
+	scanCmd.Flags().StringVar(&scanUAField, "ua-field", "http_user_agent", "User-Agent field of JSON logs")
+	scanCmd.Flags().IntVar(&scanTop, "top", 10, "Number of top offending IPs to report, 0 for all")
+}
+
+// scanLog parses a log file, calling fn for every entry, and returns the
+// number of lines which could not be parsed.
+func scanLog(parser *accesslog.Parser, file string, fn func(accesslog.Entry)) (int, error) {
+	r, err := accesslog.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = r.Close() }()
+
+	return parser.Scan(r, fn)
+}
+
+// listCategory returns the category of a list by its name.
+func listCategory(name string) string {
+	switch {
+	case slices.ContainsFunc(bots.Known, func(bot bots.Bot) bool { return slices.Contains(bot.Lists, name) }):
+		return "good-bot"
+	case strings.HasPrefix(name, "abuseipdb"):
+		return "abuse"
+	case name == "vpns" || name == "icloud-private-relay":
+		return "vpn"
+	case name == "proxies":
+		return "proxy"
+	case name == "tor-exit-nodes":
+		return "tor"
+	default:
+		return "other"
+	}
+}
+
+// writeScanReport writes the text report to stdout.
+func writeScanReport(report scanReport) {
+	fmt.Printf(
+		"Scanned %s requests from %s IPs (%s unparsed lines)\n\n",
+		lib.NumberFormat(report.Requests),
+		lib.NumberFormat(report.IPs),
+		lib.NumberFormat(report.Unparsed),
+	)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CATEGORY\tREQUESTS\tPERCENT")
+	for _, category := range scanCategories {
+		count := report.Categories[category]
+		fmt.Fprintf(w, "%s\t%s\t%s\n", category, lib.NumberFormat(count), percent(count, report.Requests))
+	}
+	_ = w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LIST\tCATEGORY\tREQUESTS\tIPS")
+	for _, h := range report.Lists {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", h.List, h.Category, lib.NumberFormat(h.Requests), lib.NumberFormat(h.IPs))
+	}
+	_ = w.Flush()
+
+	if len(report.Offenders) == 0 {
+		return
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOP OFFENDING IPS\tREQUESTS\tLISTS")
+	for _, o := range report.Offenders {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", o.IP, lib.NumberFormat(o.Requests), strings.Join(o.Lists, ", "))
+	}
+	_ = w.Flush()
+}
+
+// percent formats a count as a percentage of the total.
+func percent(count, total int) string {
+	if total == 0 {
+		return "0.0%"
+	}
+
+	return fmt.Sprintf("%.1f%%", float64(count)*100/float64(total))
+}
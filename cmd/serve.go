@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iplists/cmd/internal/server"
+	"iplists/pkg/realip"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveListen   string
+	serveListsDir string
+	serveWatch    time.Duration
+	serveTrusted  []string
+	serveHeaders  []string
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Args:  cobra.NoArgs,
+	Short: "Serve list lookups and list contents over HTTP",
+	Long: `Loads the lists into memory and serves them over HTTP:
+
+  GET /lookup             JSON of the lists & entries containing the client IP
+  GET /lookup/{ip|cidr}   JSON of the lists & entries containing an IP or overlapping a CIDR
+  GET /lists              JSON array of list names
+  GET /lists/{name}       list contents, with ETag & Last-Modified (?format=txt, json
+                          or any export format)
+  GET /healthz            health check
+
+The lists are reloaded on SIGHUP, and when a list file is added, removed or
+modified (checked every --watch interval, 0 to disable).
+
+When behind proxies, use --trusted-proxies with the list file(s) of the proxies,
+eg: lists/cloudflare.txt, to resolve the client IP from their forwarded headers
+(--proxy-header, default X-Forwarded-For). Forwarded headers from any other peer
+are ignored.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		srv, err := server.New(serveListsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading lists: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(serveTrusted) > 0 {
+			trusted, err := realip.LoadTrusted(serveTrusted...)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading trusted proxies: %v\n", err)
+				os.Exit(1)
+			}
+			srv.TrustProxies(realip.New(trusted, serveHeaders...))
+		}
+
+		done := make(chan struct{})
+		if serveWatch > 0 {
+			go srv.Watch(serveWatch, done)
+		}
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				if err := srv.Reload(); err != nil {
+					log.Printf("Error reloading lists: %v", err)
+					continue
+				}
+				log.Printf("Reloaded lists from %s", serveListsDir)
+			}
+		}()
+
+		httpServer := &http.Server{
+			Addr:              serveListen,
+			Handler:           srv.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		go func() {
+			<-ctx.Done()
+			close(done)
+			shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_ = httpServer.Shutdown(shutdown)
+		}()
+
+		log.Printf("Serving lists from %s on %s", serveListsDir, serveListen)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "Error serving: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVarP(&serveListen, "listen", "l", ":8080", "Address to listen on")
+	serveCmd.Flags().StringVar(&serveListsDir, "lists-dir", "lists", "Directory of lists to serve")
+	serveCmd.Flags().DurationVar(&serveWatch, "watch", 10*time.Second, "Interval to check the lists for changes")
+	serveCmd.Flags().StringSliceVar(&serveTrusted, "trusted-proxies", []string{}, "List file(s) of proxies whose forwarded headers are trusted")
+	serveCmd.Flags().StringSliceVar(&serveHeaders, "proxy-header", []string{}, "Forwarded header(s) of trusted proxies (default X-Forwarded-For)")
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync lists to cloud WAFs",
+	Long: `Sync lists to the IP lists & sets of cloud WAFs, applying only the changes
+between the local and remote lists.`,
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"iplists/cmd/internal/awswaf"
+	"iplists/cmd/internal/export"
+	"iplists/cmd/internal/lib"
+	"iplists/internal/cidr"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncAWSIPv4     string
+	syncAWSIPv6     string
+	syncAWSScope    string
+	syncAWSRegion   string
+	syncAWSEndpoint string
+	syncAWSDryRun   bool
+	syncAWSTimeout  time.Duration
+)
+
+// syncAWSCmd represents the sync aws command
+var syncAWSCmd = &cobra.Command{
+	Use:   "aws [--ipv4 <name>] [--ipv6 <name>] <file> [<file>...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Sync lists to AWS WAFv2 IPSets",
+	Long: `Sync one or more lists to AWS WAFv2 IPSets, the IPv4 entries to the --ipv4 set
+and the IPv6 entries to the --ipv6 set. An IPSet is only updated if its
+addresses differ, and the update is retried if the IPSet was changed since it
+was read.
+
+The region can be specified via --region flag or AWS_REGION environment
+variable, CLOUDFRONT scope IPSets are always in us-east-1. Use --endpoint to
+use another endpoint than the region endpoint.
+AWS credentials must be set in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY,
+and AWS_SESSION_TOKEN for temporary credentials.`,
+	Run: func(_ *cobra.Command, args []string) {
+		if syncAWSIPv4 == "" && syncAWSIPv6 == "" {
+			fmt.Fprintln(os.Stderr, "At least one IPSet must be specified via --ipv4 or --ipv6 flags")
+			os.Exit(1)
+		}
+		if syncAWSScope != "REGIONAL" && syncAWSScope != "CLOUDFRONT" {
+			fmt.Fprintln(os.Stderr, "--scope must be one of REGIONAL or CLOUDFRONT")
+			os.Exit(1)
+		}
+
+		region := syncAWSRegion
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+		if syncAWSScope == "CLOUDFRONT" {
+			region = "us-east-1"
+		}
+		if region == "" {
+			fmt.Fprintln(os.Stderr, "Region must be specified via --region flag or AWS_REGION environment variable")
+			os.Exit(1)
+		}
+
+		prefixes, err := cidr.LoadFiles(args...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading lists: %v\n", err)
+			os.Exit(1)
+		}
+		list := export.List{Prefixes: cidr.Aggregate(prefixes)}
+
+		client, err := awswaf.NewClientFromEnv(syncAWSEndpoint, region)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing AWS WAF client: %v\n", err)
+			os.Exit(1)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), syncAWSTimeout)
+		defer cancel()
+
+		for _, family := range []struct {
+			name     string
+			version  string
+			prefixes []netip.Prefix
+		}{
+			{syncAWSIPv4, "IPV4", list.IPv4()},
+			{syncAWSIPv6, "IPV6", list.IPv6()},
+		} {
+			if family.name == "" {
+				if len(family.prefixes) > 0 {
+					fmt.Fprintf(os.Stderr, "Skipping %s %s entries without an IPSet\n", lib.NumberFormat(len(family.prefixes)), family.version)
+				}
+				continue
+			}
+
+			if err := syncAWSIPSet(ctx, client, family.name, family.version, family.prefixes); err != nil {
+				fmt.Fprintf(os.Stderr, "Error syncing IPSet %s: %v\n", family.name, err)
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	syncCmd.AddCommand(syncAWSCmd)
+
+	syncAWSCmd.Flags().StringVar(&syncAWSIPv4, "ipv4", "", "Name of the IPv4 IPSet")
+	syncAWSCmd.Flags().StringVar(&syncAWSIPv6, "ipv6", "", "Name of the IPv6 IPSet")
+	syncAWSCmd.Flags().StringVar(&syncAWSScope, "scope", export.DefaultOptions.Scope, "Scope of the IPSets (REGIONAL or CLOUDFRONT)")
+	syncAWSCmd.Flags().StringVar(&syncAWSRegion, "region", "", "AWS region (or AWS_REGION environment variable)")
+	syncAWSCmd.Flags().StringVar(&syncAWSEndpoint, "endpoint", "", "WAFv2 endpoint URL (default the region endpoint)")
+	syncAWSCmd.Flags().BoolVar(&syncAWSDryRun, "dry-run", false, "Show the changes without applying them")
+	syncAWSCmd.Flags().DurationVar(&syncAWSTimeout, "timeout", 5*time.Minute, "Timeout of the sync")
+}
+
+// syncAWSIPSet updates the addresses of an IPSet to the prefixes, printing
+// the changes instead with --dry-run.
+func syncAWSIPSet(ctx context.Context, client *awswaf.Client, name, version string, prefixes []netip.Prefix) error {
+	add, remove, err := client.SyncIPSet(ctx, syncAWSScope, name, version, prefixes, syncAWSDryRun)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(add) == 0 && len(remove) == 0:
+		fmt.Printf("%s is up to date with %s entries\n", name, lib.NumberFormat(len(prefixes)))
+	case syncAWSDryRun:
+		for _, address := range add {
+			fmt.Printf("+ %s\n", address)
+		}
+		for _, address := range remove {
+			fmt.Printf("- %s\n", address)
+		}
+	default:
+		fmt.Printf(
+			"Synced %s: added %s and removed %s entries\n",
+			name,
+			lib.NumberFormat(len(add)),
+			lib.NumberFormat(len(remove)),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"iplists/cmd/internal/cloudflare"
+	"iplists/cmd/internal/export"
+	"iplists/cmd/internal/lib"
+	"iplists/internal/cidr"
+	"iplists/pkg/lists"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncCloudflareAccount string
+	syncCloudflareList    string
+	syncCloudflareComment string
+	syncCloudflareAPIURL  string
+	syncCloudflareDryRun  bool
+	syncCloudflareTimeout time.Duration
+)
+
+// syncCloudflareCmd represents the sync cloudflare command
+var syncCloudflareCmd = &cobra.Command{
+	Use:   "cloudflare --account <id> --list <name> <file> [<file>...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Sync lists to a Cloudflare IP List",
+	Long: `Sync one or more lists to a Cloudflare account IP List, adding the missing
+entries and deleting the extra entries rather than replacing the whole list.
+Additions are applied before deletions so no entry is ever left unlisted.
+
+Entries are limited to the prefix lengths Cloudflare accepts, eg: IPv6 entries
+are widened to their /64. Bulk operations are polled until complete and rate
+limited requests are retried.
+
+CLOUDFLARE_API_TOKEN environment variable must be set with an API token with
+the Account Filter Lists Edit permission. The account can also be set with the
+CLOUDFLARE_ACCOUNT_ID environment variable.`,
+	Run: func(_ *cobra.Command, args []string) {
+		token := os.Getenv("CLOUDFLARE_API_TOKEN")
+		if token == "" {
+			fmt.Fprintln(os.Stderr, "CLOUDFLARE_API_TOKEN environment variable must be set")
+			os.Exit(1)
+		}
+
+		account := syncCloudflareAccount
+		if account == "" {
+			account = os.Getenv("CLOUDFLARE_ACCOUNT_ID")
+		}
+		if account == "" {
+			fmt.Fprintln(os.Stderr, "Account must be specified via --account flag or CLOUDFLARE_ACCOUNT_ID environment variable")
+			os.Exit(1)
+		}
+
+		prefixes, err := cidr.LoadFiles(args...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading lists: %v\n", err)
+			os.Exit(1)
+		}
+		prefixes = export.CloudflarePrefixes(cidr.Aggregate(prefixes))
+
+		comment := syncCloudflareComment
+		if comment == "" {
+			comment = lists.Name(args[0])
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), syncCloudflareTimeout)
+		defer cancel()
+
+		client := cloudflare.NewClient(syncCloudflareAPIURL, token)
+		listID, err := client.ListID(ctx, account, syncCloudflareList)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error finding list: %v\n", err)
+			os.Exit(1)
+		}
+
+		items, err := client.Items(ctx, account, listID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching list items: %v\n", err)
+			os.Exit(1)
+		}
+
+		add, remove := cloudflare.Diff(items, prefixes, comment)
+		if len(add) == 0 && len(remove) == 0 {
+			fmt.Printf("%s is up to date with %s entries\n", syncCloudflareList, lib.NumberFormat(len(prefixes)))
+			return
+		}
+
+		if syncCloudflareDryRun {
+			for _, item := range add {
+				fmt.Printf("+ %s\n", item.IP)
+			}
+			for _, item := range remove {
+				fmt.Printf("- %s\n", item.IP)
+			}
+			return
+		}
+
+		if err := client.AddItems(ctx, account, listID, add); err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding list items: %v\n", err)
+			os.Exit(1)
+		}
+		ids := make([]string, 0, len(remove))
+		for _, item := range remove {
+			ids = append(ids, item.ID)
+		}
+		if err := client.DeleteItems(ctx, account, listID, ids); err != nil {
+			fmt.Fprintf(os.Stderr, "Error deleting list items: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf(
+			"Synced %s: added %s and deleted %s entries\n",
+			syncCloudflareList,
+			lib.NumberFormat(len(add)),
+			lib.NumberFormat(len(remove)),
+		)
+	},
+}
+
+func init() {
+	syncCmd.AddCommand(syncCloudflareCmd)
+
+	syncCloudflareCmd.Flags().StringVar(&syncCloudflareAccount, "account", "", "Cloudflare account ID")
+	syncCloudflareCmd.Flags().StringVar(&syncCloudflareList, "list", "", "Name of the IP List (required)")
+	syncCloudflareCmd.Flags().StringVar(&syncCloudflareComment, "comment", "", "Comment of added entries (default the list file name)")
+	syncCloudflareCmd.Flags().StringVar(&syncCloudflareAPIURL, "api-url", cloudflare.DefaultBaseURL, "Cloudflare API base URL")
+	syncCloudflareCmd.Flags().BoolVar(&syncCloudflareDryRun, "dry-run", false, "Show the changes without applying them")
+	syncCloudflareCmd.Flags().DurationVar(&syncCloudflareTimeout, "timeout", 10*time.Minute, "Timeout of the sync")
+	_ = syncCloudflareCmd.MarkFlagRequired("list")
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"iplists/pkg/bots"
+	"iplists/pkg/lists"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyBotUA       string
+	verifyBotIP       string
+	verifyBotListsDir string
+)
+
+// verifyBotCmd represents the verify-bot command
+var verifyBotCmd = &cobra.Command{
+	Use:   "verify-bot",
+	Args:  cobra.NoArgs,
+	Short: "Verify a crawler User-Agent against its published IPs",
+	Long: `Verify that a request claiming to be a known crawler by its User-Agent, eg:
+Googlebot, Bingbot or GPTBot, comes from the IPs published for that crawler.
+
+The verdict is one of:
+
+  genuine   the IP is in the crawler's list
+  spoofed   the IP is not in the crawler's list (exit status 2)
+  unknown   the User-Agent is not a known crawler`,
+	Run: func(_ *cobra.Command, _ []string) {
+		addr, err := netip.ParseAddr(verifyBotIP)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid IP: %s\n", verifyBotIP)
+			os.Exit(1)
+		}
+
+		set, err := lists.LoadDir(verifyBotListsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading lists from %s: %v\n", verifyBotListsDir, err)
+			os.Exit(1)
+		}
+
+		result := bots.NewVerifier(set).Verify(verifyBotUA, addr)
+		switch result.Verdict {
+		case bots.Genuine:
+			fmt.Printf("genuine: %s from %s (%s)\n", result.Bot, addr, strings.Join(result.Lists, ", "))
+		case bots.Spoofed:
+			fmt.Printf("spoofed: %s is not from %s\n", addr, result.Bot)
+			os.Exit(2)
+		default:
+			if result.Bot != "" {
+				fmt.Printf("unknown: no list found for %s in %s\n", result.Bot, verifyBotListsDir)
+				return
+			}
+			fmt.Println("unknown: not a known crawler")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyBotCmd)
+
+	verifyBotCmd.Flags().StringVar(&verifyBotUA, "ua", "", "User-Agent of the request")
+	verifyBotCmd.Flags().StringVar(&verifyBotIP, "ip", "", "IP of the request")
+	verifyBotCmd.Flags().StringVar(&verifyBotListsDir, "lists-dir", "lists", "Directory of lists")
+	_ = verifyBotCmd.MarkFlagRequired("ua")
+	_ = verifyBotCmd.MarkFlagRequired("ip")
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"iplists/cmd/internal/accesslog"
+	"iplists/cmd/internal/lib"
+	"iplists/pkg/bots"
+	"iplists/pkg/lists"
+	"iplists/pkg/realip"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyRdnsResolver    string
+	verifyRdnsListsDir    string
+	verifyRdnsConcurrency int
+	verifyRdnsTimeout     time.Duration
+	verifyRdnsMissing     bool
+)
+
+// verifyRdnsCmd represents the verify-rdns command
+var verifyRdnsCmd = &cobra.Command{
+	Use:   "verify-rdns <ip|file|-> [<ip|file>...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Verify crawler IPs by forward-confirmed reverse DNS",
+	Long: `Verify IPs by forward-confirmed reverse DNS (FCrDNS): a PTR lookup of the IP
+in a known crawler domain, eg: googlebot.com or search.msn.com, followed by a
+forward lookup of the host confirming it resolves back to the IP.
+
+Arguments are IPs, or files (a log extract or "-" for stdin) from which the first
+IP of each line is read. The results are tab separated (ip, host, crawlers,
+verified, listed), where listed is whether the IP is in the published list of
+the crawler. Use --missing to only output IPs which verify via DNS but are
+missing from the published lists.
+
+Use --resolver to send queries to a specific DNS server, eg: 127.0.0.1:5353.`,
+	Run: func(_ *cobra.Command, args []string) {
+		addrs, err := verifyRdnsAddrs(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %v\n", err)
+			os.Exit(1)
+		}
+		if len(addrs) == 0 {
+			fmt.Fprintln(os.Stderr, "No IPs found")
+			os.Exit(1)
+		}
+
+		set, err := lists.LoadDir(verifyRdnsListsDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading lists from %s: %v\n", verifyRdnsListsDir, err)
+			os.Exit(1)
+		}
+
+		verifier := bots.NewDNSVerifier(set, verifyRdnsResolver)
+		results := make([]bots.DNSResult, len(addrs))
+		errs := make([]error, len(addrs))
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, max(verifyRdnsConcurrency, 1))
+		for i, addr := range addrs {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				ctx, cancel := context.WithTimeout(context.Background(), verifyRdnsTimeout)
+				defer cancel()
+				results[i], errs[i] = verifier.Verify(ctx, addr)
+			}()
+		}
+		wg.Wait()
+
+		verified, missing, failed := 0, 0, 0
+		for i, result := range results {
+			if errs[i] != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "Error verifying %s: %v\n", addrs[i], errs[i])
+				continue
+			}
+			if result.Verified {
+				verified++
+			}
+			if result.Missing() {
+				missing++
+			}
+			if verifyRdnsMissing && !result.Missing() {
+				continue
+			}
+
+			fmt.Printf(
+				"%s\t%s\t%s\t%t\t%t\n",
+				result.IP,
+				result.Host,
+				strings.Join(result.Bots, ","),
+				result.Verified,
+				result.Listed,
+			)
+		}
+
+		fmt.Fprintf(
+			os.Stderr,
+			"Verified %s of %s IPs via DNS, %s missing from the published lists\n",
+			lib.NumberFormat(verified),
+			lib.NumberFormat(len(addrs)),
+			lib.NumberFormat(missing),
+		)
+
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyRdnsCmd)
+
+	verifyRdnsCmd.Flags().StringVar(&verifyRdnsResolver, "resolver", "", "DNS server address (default system resolver)")
+	verifyRdnsCmd.Flags().StringVar(&verifyRdnsListsDir, "lists-dir", "lists", "Directory of lists")
+	verifyRdnsCmd.Flags().IntVarP(&verifyRdnsConcurrency, "concurrency", "c", 16, "Number of concurrent lookups")
+	verifyRdnsCmd.Flags().DurationVar(&verifyRdnsTimeout, "timeout", 10*time.Second, "Timeout of the lookups for each IP")
+	verifyRdnsCmd.Flags().BoolVar(&verifyRdnsMissing, "missing", false, "Only output IPs missing from the published lists")
+}
+
+// verifyRdnsAddrs returns the unique IPs of the arguments, in order.
+func verifyRdnsAddrs(args []string) ([]netip.Addr, error) {
+	addrs := []netip.Addr{}
+	seen := map[netip.Addr]bool{}
+	add := func(addr netip.Addr) {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+
+	parser, err := accesslog.NewParser(accesslog.Plain, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arg := range args {
+		if addr, err := realip.ParseHost(arg); err == nil {
+			add(addr)
+			continue
+		}
+
+		r, err := accesslog.Open(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", inputName(arg), err)
+		}
+
+		_, err = parser.Scan(r, func(e accesslog.Entry) {
+			add(e.IP)
+		})
+		_ = r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", inputName(arg), err)
+		}
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,370 @@
+package cidr
+
+import (
+	"bufio"
+	"cmp"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+)
+
+// DefaultChunkSize is the number of ranges held in memory by an Aggregator
+// before they are sorted and spilled to temporary files.
+const DefaultChunkSize = 1 << 22
+
+// spanSize is the encoded size of a spilled span
+const spanSize = 32
+
+// Aggregator merges a stream of prefixes into sorted ranges. Inputs larger than
+// the chunk size are sorted in chunks which are spilled to temporary files and
+// merged when the ranges are read (an external merge sort).
+type Aggregator struct {
+	chunkSize int
+	// buffered spans, indexed by family (0 = IPv4, 1 = IPv6)
+	buf [2][]span
+	// spilled chunks, indexed by family
+	chunks [2][]*os.File
+	// Count is the number of prefixes added
+	Count int
+}
+
+// span is a compact, pointer-free range of 128-bit integers, which is
+// considerably faster to sort than a Range. IPv4 addresses use the low 32 bits.
+type span struct {
+	from, to uint128
+}
+
+type uint128 struct {
+	hi, lo uint64
+}
+
+// NewAggregator returns an Aggregator which holds up to chunkSize ranges in
+// memory, or DefaultChunkSize if chunkSize <= 0.
+func NewAggregator(chunkSize int) *Aggregator {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	return &Aggregator{chunkSize: chunkSize}
+}
+
+// Add adds a prefix to the aggregator.
+func (a *Aggregator) Add(p netip.Prefix) error {
+	family := 0
+	if p.Addr().Is6() {
+		family = 1
+	}
+	a.buf[family] = append(a.buf[family], span{from: toUint128(p.Masked().Addr()), to: toUint128(Last(p))})
+	a.Count++
+
+	if len(a.buf[0])+len(a.buf[1]) >= a.chunkSize {
+		return a.spill()
+	}
+
+	return nil
+}
+
+// Ranges calls fn for every merged range in canonical order.
+func (a *Aggregator) Ranges(fn func(Range) error) error {
+	for family := range a.buf {
+		a.buf[family] = mergeSpans(sortSpans(a.buf[family]))
+
+		readers := []*chunkReader{{spans: a.buf[family]}}
+		for _, f := range a.chunks[family] {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			readers = append(readers, &chunkReader{r: bufio.NewReader(f)})
+		}
+
+		if err := mergeChunks(readers, func(s span) error {
+			return fn(s.toRange(family == 1))
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Prefixes returns the minimum set of prefixes covering everything added,
+// in canonical order.
+func (a *Aggregator) Prefixes() ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	err := a.Ranges(func(r Range) error {
+		prefixes = append(prefixes, r.Prefixes()...)
+		return nil
+	})
+
+	return prefixes, err
+}
+
+// Close removes any temporary files.
+func (a *Aggregator) Close() error {
+	var errs []error
+	for family := range a.chunks {
+		for _, f := range a.chunks[family] {
+			errs = append(errs, f.Close(), os.Remove(f.Name()))
+		}
+		a.chunks[family] = nil
+		a.buf[family] = nil
+	}
+
+	return errors.Join(errs...)
+}
+
+// spill sorts & merges the buffered spans and writes them to temporary files.
+func (a *Aggregator) spill() error {
+	for family := range a.buf {
+		if len(a.buf[family]) == 0 {
+			continue
+		}
+
+		f, err := os.CreateTemp("", "iplists-*.chunk")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		a.chunks[family] = append(a.chunks[family], f)
+
+		w := bufio.NewWriter(f)
+		b := make([]byte, spanSize)
+		for _, s := range mergeSpans(sortSpans(a.buf[family])) {
+			binary.BigEndian.PutUint64(b[0:], s.from.hi)
+			binary.BigEndian.PutUint64(b[8:], s.from.lo)
+			binary.BigEndian.PutUint64(b[16:], s.to.hi)
+			binary.BigEndian.PutUint64(b[24:], s.to.lo)
+			if _, err := w.Write(b); err != nil {
+				return fmt.Errorf("failed to write temporary file: %w", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to write temporary file: %w", err)
+		}
+		a.buf[family] = a.buf[family][:0]
+	}
+
+	return nil
+}
+
+// mergeChunks merges sorted chunks, calling fn for each joined span.
+func mergeChunks(readers []*chunkReader, fn func(span) error) error {
+	h := &chunkHeap{}
+	for _, cr := range readers {
+		ok, err := cr.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.readers = append(h.readers, cr)
+		}
+	}
+	heap.Init(h)
+
+	var current span
+	started := false
+	for h.Len() > 0 {
+		cr := h.readers[0]
+		s := cr.current
+
+		if ok, err := cr.next(); err != nil {
+			return err
+		} else if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+
+		if started && joinSpan(&current, s) {
+			continue
+		}
+		if started {
+			if err := fn(current); err != nil {
+				return err
+			}
+		}
+		current, started = s, true
+	}
+
+	if started {
+		return fn(current)
+	}
+
+	return nil
+}
+
+// sortRanges sorts ranges by their first address.
+func sortRanges(ranges []Range) []Range {
+	slices.SortFunc(ranges, func(a, b Range) int {
+		return a.From.Compare(b.From)
+	})
+
+	return ranges
+}
+
+// mergeSorted joins overlapping and adjacent ranges in place.
+func mergeSorted(ranges []Range) []Range {
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && join(&merged[n-1], r) {
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// join extends last with r if they overlap or are adjacent, where r does not
+// start before last.
+func join(last *Range, r Range) bool {
+	if last.From.Is4() != r.From.Is4() {
+		return false
+	}
+	if last.To.Less(r.From) && last.To.Next() != r.From {
+		return false
+	}
+	if last.To.Less(r.To) {
+		last.To = r.To
+	}
+
+	return true
+}
+
+// sortSpans sorts spans by their first address.
+func sortSpans(spans []span) []span {
+	slices.SortFunc(spans, func(a, b span) int {
+		return a.from.compare(b.from)
+	})
+
+	return spans
+}
+
+// mergeSpans joins overlapping and adjacent spans in place.
+func mergeSpans(spans []span) []span {
+	merged := spans[:0]
+	for _, s := range spans {
+		if n := len(merged); n > 0 && joinSpan(&merged[n-1], s) {
+			continue
+		}
+		merged = append(merged, s)
+	}
+
+	return merged
+}
+
+// joinSpan extends last with s if they overlap or are adjacent, where s does
+// not start before last.
+func joinSpan(last *span, s span) bool {
+	if last.to.compare(s.from) < 0 && last.to.next() != s.from {
+		return false
+	}
+	if last.to.compare(s.to) < 0 {
+		last.to = s.to
+	}
+
+	return true
+}
+
+func toUint128(addr netip.Addr) uint128 {
+	if addr.Is4() {
+		b := addr.As4()
+		return uint128{lo: uint64(binary.BigEndian.Uint32(b[:]))}
+	}
+
+	b := addr.As16()
+
+	return uint128{hi: binary.BigEndian.Uint64(b[:8]), lo: binary.BigEndian.Uint64(b[8:])}
+}
+
+func (u uint128) toAddr(ipv6 bool) netip.Addr {
+	if !ipv6 {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(u.lo))
+		return netip.AddrFrom4(b)
+	}
+
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], u.hi)
+	binary.BigEndian.PutUint64(b[8:], u.lo)
+
+	return netip.AddrFrom16(b)
+}
+
+func (u uint128) compare(v uint128) int {
+	if c := cmp.Compare(u.hi, v.hi); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(u.lo, v.lo)
+}
+
+// next returns u+1, wrapping to zero after the maximum value.
+func (u uint128) next() uint128 {
+	lo := u.lo + 1
+	hi := u.hi
+	if lo == 0 {
+		hi++
+	}
+
+	return uint128{hi: hi, lo: lo}
+}
+
+func (s span) toRange(ipv6 bool) Range {
+	return Range{From: s.from.toAddr(ipv6), To: s.to.toAddr(ipv6)}
+}
+
+// chunkReader reads sorted spans from memory or a spilled chunk
+type chunkReader struct {
+	r       *bufio.Reader
+	spans   []span
+	current span
+	buf     [spanSize]byte
+}
+
+// next advances to the next span, returning false when the chunk is exhausted.
+func (c *chunkReader) next() (bool, error) {
+	if c.r == nil {
+		if len(c.spans) == 0 {
+			return false, nil
+		}
+		c.current, c.spans = c.spans[0], c.spans[1:]
+		return true, nil
+	}
+
+	if _, err := io.ReadFull(c.r, c.buf[:]); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read temporary file: %w", err)
+	}
+	c.current = span{
+		from: uint128{hi: binary.BigEndian.Uint64(c.buf[0:]), lo: binary.BigEndian.Uint64(c.buf[8:])},
+		to:   uint128{hi: binary.BigEndian.Uint64(c.buf[16:]), lo: binary.BigEndian.Uint64(c.buf[24:])},
+	}
+
+	return true, nil
+}
+
+// chunkHeap orders chunk readers by their current span
+type chunkHeap struct {
+	readers []*chunkReader
+}
+
+func (h *chunkHeap) Len() int { return len(h.readers) }
+func (h *chunkHeap) Less(i, j int) bool {
+	return h.readers[i].current.from.compare(h.readers[j].current.from) < 0
+}
+func (h *chunkHeap) Swap(i, j int) { h.readers[i], h.readers[j] = h.readers[j], h.readers[i] }
+func (h *chunkHeap) Push(x any)    { h.readers = append(h.readers, x.(*chunkReader)) }
+func (h *chunkHeap) Pop() any {
+	old := h.readers
+	n := len(old)
+	x := old[n-1]
+	h.readers = old[:n-1]
+	return x
+}
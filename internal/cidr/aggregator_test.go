@@ -0,0 +1,154 @@
+package cidr
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"os"
+	"slices"
+	"testing"
+)
+
+// randomPrefixes returns n prefixes within a few small ranges of each family,
+// so they often overlap or are adjacent.
+func randomPrefixes(r *rand.Rand, n int) []netip.Prefix {
+	prefixes := make([]netip.Prefix, n)
+	for i := range prefixes {
+		if r.IntN(2) == 0 {
+			addr := netip.AddrFrom4([4]byte{byte(1 + r.IntN(3)), 0, byte(r.IntN(256)), byte(r.IntN(256))})
+			prefixes[i] = netip.PrefixFrom(addr, 20+r.IntN(13)).Masked()
+			continue
+		}
+
+		b := netip.MustParseAddr("2001:db8::").As16()
+		b[13], b[14], b[15] = byte(r.IntN(3)), byte(r.IntN(256)), byte(r.IntN(256))
+		prefixes[i] = netip.PrefixFrom(netip.AddrFrom16(b), 108+r.IntN(21)).Masked()
+	}
+
+	return prefixes
+}
+
+func aggregate(t *testing.T, prefixes []netip.Prefix, chunkSize int) ([]netip.Prefix, int) {
+	t.Helper()
+
+	agg := NewAggregator(chunkSize)
+	for _, p := range prefixes {
+		if err := agg.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chunks := len(agg.chunks[0]) + len(agg.chunks[1])
+	files := []string{}
+	for family := range agg.chunks {
+		for _, f := range agg.chunks[family] {
+			files = append(files, f.Name())
+		}
+	}
+
+	result, err := agg.Prefixes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := agg.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("temporary file %s not removed", file)
+		}
+	}
+
+	return result, chunks
+}
+
+func TestAggregatorSpill(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+
+	for _, n := range []int{1, 10, 1000, 20000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			prefixes := randomPrefixes(r, n)
+
+			want := Aggregate(prefixes)
+			inMemory, chunks := aggregate(t, prefixes, 0)
+			if chunks != 0 {
+				t.Fatalf("spilled %d chunks with the default chunk size", chunks)
+			}
+			if !slices.Equal(inMemory, want) {
+				t.Fatalf("in memory = %v, want %v", inMemory, want)
+			}
+
+			spilled, chunks := aggregate(t, prefixes, 7)
+			if n >= 7 && chunks == 0 {
+				t.Fatal("no chunks spilled")
+			}
+			if !slices.Equal(spilled, want) {
+				t.Fatalf("spilled = %v, want %v", spilled, want)
+			}
+		})
+	}
+}
+
+func TestAggregatorMerges(t *testing.T) {
+	agg := NewAggregator(2)
+	defer func() { _ = agg.Close() }()
+
+	for _, entry := range []string{
+		"2001:db8::1", "1.0.0.128/25", "2001:db8::", "1.0.0.0/25", "1.0.0.5", "1.0.1.0", "1.0.1.1",
+	} {
+		p, err := Parse(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := agg.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := agg.Prefixes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []netip.Prefix{
+		netip.MustParsePrefix("1.0.0.0/24"),
+		netip.MustParsePrefix("1.0.1.0/31"),
+		netip.MustParsePrefix("2001:db8::/127"),
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("Prefixes() = %v, want %v", got, want)
+	}
+	if agg.Count != 7 {
+		t.Fatalf("Count = %d, want 7", agg.Count)
+	}
+}
+
+// BenchmarkAggregator parses & aggregates 1M random IPv4 lines per op, the
+// rate to check against the target of 10M lines in seconds.
+func BenchmarkAggregator(b *testing.B) {
+	r := rand.New(rand.NewPCG(1, 2))
+	lines := make([]string, 1_000_000)
+	for i := range lines {
+		lines[i] = netip.AddrFrom4([4]byte{byte(r.IntN(224)), byte(r.IntN(256)), byte(r.IntN(256)), byte(r.IntN(256))}).String()
+	}
+
+	for b.Loop() {
+		agg := NewAggregator(0)
+		for _, line := range lines {
+			p, err := Parse(line)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := agg.Add(p); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if _, err := agg.Prefixes(); err != nil {
+			b.Fatal(err)
+		}
+		_ = agg.Close()
+	}
+
+	b.ReportMetric(float64(len(lines))*float64(b.N)/b.Elapsed().Seconds(), "lines/s")
+}
@@ -0,0 +1,208 @@
+// Package cidr provides IP & CIDR arithmetic built on net/netip.
+package cidr
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+var (
+	// IPv4All is the entire IPv4 address space
+	IPv4All = netip.MustParsePrefix("0.0.0.0/0")
+	// IPv6All is the entire IPv6 address space
+	IPv6All = netip.MustParsePrefix("::/0")
+)
+
+// Range is an inclusive range of addresses of the same family.
+type Range struct {
+	From netip.Addr
+	To   netip.Addr
+}
+
+// Parse parses an IP or CIDR, returning the masked prefix.
+// A single IP is returned as a /32 (IPv4) or /128 (IPv6) prefix.
+func Parse(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid IP or CIDR: %s", s)
+		}
+		addr = addr.Unmap().WithZone("")
+
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP or CIDR: %s", s)
+	}
+
+	addr := p.Addr()
+	if addr.Is4In6() && p.Bits() >= 96 {
+		// an IPv4-mapped CIDR, treat as IPv4
+		p = netip.PrefixFrom(addr.Unmap(), p.Bits()-96)
+	}
+
+	return p.Masked(), nil
+}
+
+// Format returns the string representation of the prefix, omitting the
+// prefix length for a single IPv4 or IPv6 address.
+func Format(p netip.Prefix) string {
+	if p.IsSingleIP() {
+		return p.Addr().String()
+	}
+
+	return p.String()
+}
+
+// Last returns the last address in the prefix.
+func Last(p netip.Prefix) netip.Addr {
+	addr := p.Masked().Addr()
+	if addr.Is4() {
+		b := addr.As4()
+		setHostBits(b[:], p.Bits())
+		return netip.AddrFrom4(b)
+	}
+
+	b := addr.As16()
+	setHostBits(b[:], p.Bits())
+
+	return netip.AddrFrom16(b)
+}
+
+// Merge returns the sorted ranges covered by the given prefixes, with
+// overlapping and adjacent prefixes joined together.
+func Merge(prefixes []netip.Prefix) []Range {
+	ranges := make([]Range, 0, len(prefixes))
+	for _, p := range prefixes {
+		ranges = append(ranges, Range{From: p.Masked().Addr(), To: Last(p)})
+	}
+
+	return mergeSorted(sortRanges(ranges))
+}
+
+// Prefixes returns the minimum set of prefixes covering the range.
+func (r Range) Prefixes() []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	from := r.From
+
+	for from.IsValid() && !r.To.Less(from) {
+		// start with the largest prefix aligned to from, and shrink it
+		// until it fits within the range
+		bits := from.BitLen() - trailingZeros(from)
+		p := netip.PrefixFrom(from, bits)
+		for r.To.Less(Last(p)) {
+			bits++
+			p = netip.PrefixFrom(from, bits)
+		}
+		prefixes = append(prefixes, p)
+
+		// Next() returns an invalid address when the end of the address space is reached
+		from = Last(p).Next()
+	}
+
+	return prefixes
+}
+
+// Complement returns the minimum set of prefixes within the given prefix
+// which are not covered by any of the excluded prefixes.
+func Complement(within netip.Prefix, exclude []netip.Prefix) []netip.Prefix {
+	within = within.Masked()
+	end := Last(within)
+	from := within.Addr()
+	result := []netip.Prefix{}
+
+	for _, r := range Merge(exclude) {
+		if r.From.Is4() != from.Is4() || r.To.Less(from) {
+			continue
+		}
+		if end.Less(r.From) {
+			break
+		}
+		if from.Less(r.From) {
+			result = append(result, Range{From: from, To: r.From.Prev()}.Prefixes()...)
+		}
+		if !r.To.Less(end) {
+			return result
+		}
+		from = r.To.Next()
+	}
+
+	return append(result, Range{From: from, To: end}.Prefixes()...)
+}
+
+// setHostBits sets all bits after the first n bits.
+func setHostBits(b []byte, n int) {
+	for i := range b {
+		switch {
+		case n >= 8:
+			n -= 8
+		case n <= 0:
+			b[i] = 0xff
+		default:
+			b[i] |= 0xff >> n
+			n = 0
+		}
+	}
+}
+
+// trailingZeros returns the number of trailing zero bits of an address.
+func trailingZeros(addr netip.Addr) int {
+	b := addr.AsSlice()
+	zeros := 0
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] != 0 {
+			for v := b[i]; v&1 == 0; v >>= 1 {
+				zeros++
+			}
+			return zeros
+		}
+		zeros += 8
+	}
+
+	return zeros
+}
+
+// Compare returns an integer comparing two prefixes in canonical order:
+// IPv4 before IPv6, then numerically by address, then by prefix length.
+func Compare(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+
+	return a.Bits() - b.Bits()
+}
+
+// Sort sorts prefixes in canonical order.
+func Sort(prefixes []netip.Prefix) {
+	sort.Slice(prefixes, func(i, j int) bool {
+		return Compare(prefixes[i], prefixes[j]) < 0
+	})
+}
+
+// SortStrings sorts IPs & CIDRs in canonical order. Entries which cannot
+// be parsed are sorted lexically after all valid entries.
+func SortStrings(entries []string) {
+	parsed := make(map[string]netip.Prefix, len(entries))
+	for _, e := range entries {
+		if p, err := Parse(e); err == nil {
+			parsed[e] = p
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, aOK := parsed[entries[i]]
+		b, bOK := parsed[entries[j]]
+		switch {
+		case aOK && bOK:
+			return Compare(a, b) < 0
+		case aOK != bOK:
+			return aOK
+		default:
+			return entries[i] < entries[j]
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package cidr
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+)
+
+// Input is an original list entry and its parsed prefix.
+type Input struct {
+	Entry  string
+	Prefix netip.Prefix
+}
+
+// Explanation describes how an aggregated prefix was formed from the inputs.
+type Explanation struct {
+	Prefix netip.Prefix
+	// Kind is one of "unchanged", "containment", "merged" or "expanded"
+	Kind   string
+	Inputs []Input
+	// Reasons holds the reason for each input: "unchanged", "merged",
+	// "expanded", "duplicate" or "contained in <prefix>"
+	Reasons []string
+}
+
+// Explain matches every input to the aggregated prefix which absorbed it.
+// The aggregated prefixes must be sorted & cover all inputs.
+func Explain(inputs []Input, aggregated []netip.Prefix) []Explanation {
+	explanations := make([]Explanation, len(aggregated))
+	for i, p := range aggregated {
+		explanations[i].Prefix = p
+	}
+
+	sorted := make([]Input, len(inputs))
+	copy(sorted, inputs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return Compare(sorted[i].Prefix, sorted[j].Prefix) < 0
+	})
+
+	for _, in := range sorted {
+		i := sort.Search(len(aggregated), func(i int) bool {
+			return in.Prefix.Addr().Less(aggregated[i].Addr())
+		}) - 1
+		if i < 0 || !aggregated[i].Contains(in.Prefix.Addr()) {
+			continue
+		}
+		explanations[i].Inputs = append(explanations[i].Inputs, in)
+	}
+
+	for i := range explanations {
+		explanations[i].explain()
+	}
+
+	return explanations
+}
+
+// explain classifies the inputs of an aggregated prefix. Inputs are sorted so
+// any input containing another is seen first.
+func (e *Explanation) explain() {
+	e.Reasons = make([]string, len(e.Inputs))
+
+	var top netip.Prefix
+	topLevel := []int{}
+	covered := 0.0
+
+	for i, in := range e.Inputs {
+		switch {
+		case top.IsValid() && top == in.Prefix:
+			e.Reasons[i] = "duplicate"
+		case top.IsValid() && top.Overlaps(in.Prefix):
+			e.Reasons[i] = fmt.Sprintf("contained in %s", Format(top))
+		default:
+			top = in.Prefix
+			topLevel = append(topLevel, i)
+			covered += Size(in.Prefix)
+		}
+	}
+
+	switch {
+	case len(topLevel) == 1 && e.Inputs[topLevel[0]].Prefix == e.Prefix:
+		e.Kind = "unchanged"
+		if len(e.Inputs) > 1 {
+			e.Kind = "containment"
+		}
+	case covered < Size(e.Prefix):
+		e.Kind = "expanded"
+	default:
+		e.Kind = "merged"
+	}
+
+	reason := e.Kind
+	if reason == "containment" {
+		reason = "unchanged"
+	}
+	for _, i := range topLevel {
+		e.Reasons[i] = reason
+	}
+}
+
+// WriteExplanations writes a human-readable report of the explanations.
+func WriteExplanations(w io.Writer, explanations []Explanation) error {
+	for _, e := range explanations {
+		if e.Kind == "unchanged" {
+			if _, err := fmt.Fprintf(w, "%s unchanged\n", Format(e.Prefix)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "%s %s from %d entries\n", Format(e.Prefix), e.Kind, len(e.Inputs)); err != nil {
+			return err
+		}
+		for i, in := range e.Inputs {
+			if _, err := fmt.Fprintf(w, "    %s %s\n", in.Entry, e.Reasons[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package cidr
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	entries := []string{
+		"1.0.0.128/25", "1.0.0.0/25",
+		"2.0.0.5", "2.0.0.0/24",
+		"3.0.0.1", "3.0.0.1/32",
+		"4.0.0.1",
+		"5.0.0.0", "5.0.0.2",
+		"2001:db8::1", "2001:db8::",
+	}
+	inputs := []Input{}
+	for _, entry := range entries {
+		inputs = append(inputs, Input{Entry: entry, Prefix: mustPrefixes(t, entry)[0]})
+	}
+
+	// 5.0.0.0/30 as if reduced
+	aggregated := mustPrefixes(t, "1.0.0.0/24", "2.0.0.0/24", "3.0.0.1", "4.0.0.1", "5.0.0.0/30", "2001:db8::/127")
+
+	type explained struct {
+		kind    string
+		entries []string
+		reasons []string
+	}
+	want := []explained{
+		{"merged", []string{"1.0.0.0/25", "1.0.0.128/25"}, []string{"merged", "merged"}},
+		{"containment", []string{"2.0.0.0/24", "2.0.0.5"}, []string{"unchanged", "contained in 2.0.0.0/24"}},
+		{"containment", []string{"3.0.0.1", "3.0.0.1/32"}, []string{"unchanged", "duplicate"}},
+		{"unchanged", []string{"4.0.0.1"}, []string{"unchanged"}},
+		{"expanded", []string{"5.0.0.0", "5.0.0.2"}, []string{"expanded", "expanded"}},
+		{"merged", []string{"2001:db8::", "2001:db8::1"}, []string{"merged", "merged"}},
+	}
+
+	explanations := Explain(inputs, aggregated)
+	if len(explanations) != len(want) {
+		t.Fatalf("%d explanations, want %d", len(explanations), len(want))
+	}
+	for i, e := range explanations {
+		got := explained{kind: e.Kind, reasons: e.Reasons}
+		for _, in := range e.Inputs {
+			got.entries = append(got.entries, in.Entry)
+		}
+		if e.Prefix != aggregated[i] || got.kind != want[i].kind ||
+			!slices.Equal(got.entries, want[i].entries) || !slices.Equal(got.reasons, want[i].reasons) {
+			t.Errorf("Explain() of %s = %+v, want %+v", aggregated[i], got, want[i])
+		}
+	}
+
+	var b strings.Builder
+	if err := WriteExplanations(&b, explanations[:4]); err != nil {
+		t.Fatal(err)
+	}
+	wantReport := `1.0.0.0/24 merged from 2 entries
+    1.0.0.0/25 merged
+    1.0.0.128/25 merged
+2.0.0.0/24 containment from 2 entries
+    2.0.0.0/24 unchanged
+    2.0.0.5 contained in 2.0.0.0/24
+3.0.0.1 containment from 2 entries
+    3.0.0.1 unchanged
+    3.0.0.1/32 duplicate
+4.0.0.1 unchanged
+`
+	if b.String() != wantReport {
+		t.Errorf("WriteExplanations() =\n%s\nwant\n%s", b.String(), wantReport)
+	}
+}
+
+func TestExplainUncovered(t *testing.T) {
+	inputs := []Input{{Entry: "9.0.0.1", Prefix: mustPrefixes(t, "9.0.0.1")[0]}}
+	explanations := Explain(inputs, mustPrefixes(t, "1.0.0.0/24"))
+	if len(explanations) != 1 || len(explanations[0].Inputs) != 0 {
+		t.Fatalf("Explain() = %+v, want the uncovered input ignored", explanations)
+	}
+}
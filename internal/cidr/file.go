@@ -0,0 +1,56 @@
+package cidr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path"
+	"strings"
+)
+
+// LoadFiles reads and parses the IPs & CIDRs from one or more list files.
+func LoadFiles(files ...string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+
+	for _, file := range files {
+		f, err := os.Open(path.Clean(file))
+		if err != nil {
+			return nil, err
+		}
+
+		err = ReadPrefixes(f, func(p netip.Prefix) error {
+			prefixes = append(prefixes, p)
+			return nil
+		})
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	return prefixes, nil
+}
+
+// ReadPrefixes parses one IP or CIDR per line from a reader, calling fn for
+// each. Empty lines are ignored.
+func ReadPrefixes(r io.Reader, fn func(netip.Prefix) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		p, err := Parse(line)
+		if err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
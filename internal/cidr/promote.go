@@ -0,0 +1,138 @@
+package cidr
+
+import (
+	"fmt"
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Promotion is a density threshold for promoting prefixes to a covering
+// supernet. Either a minimum number of addresses (IPv6 in /64 networks, each
+// counted once however many of its addresses are listed, or in addresses for
+// supernets longer than /64) or a minimum percentage of the supernet must be
+// listed.
+type Promotion struct {
+	IPv6    bool
+	Bits    int
+	Count   float64
+	Percent float64
+}
+
+// ParsePromotion parses a promotion rule in the format of "<bits>:<count>"
+// or "<bits>:<percent>%", eg: "24:8" or "24:10%".
+func ParsePromotion(s string, ipv6 bool) (Promotion, error) {
+	rule := Promotion{IPv6: ipv6}
+	maxBits := 32
+	if ipv6 {
+		maxBits = 128
+	}
+
+	bits, threshold, found := strings.Cut(s, ":")
+	if !found {
+		return rule, fmt.Errorf("invalid promotion %q, expected <bits>:<count> or <bits>:<percent>%%", s)
+	}
+
+	b, err := strconv.Atoi(bits)
+	if err != nil || b < 0 || b > maxBits {
+		return rule, fmt.Errorf("invalid promotion prefix length %q", bits)
+	}
+	rule.Bits = b
+
+	if strings.HasSuffix(threshold, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(threshold, "%"), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return rule, fmt.Errorf("invalid promotion percentage %q", threshold)
+		}
+		rule.Percent = p
+		return rule, nil
+	}
+
+	c, err := strconv.ParseFloat(threshold, 64)
+	if err != nil || c <= 0 {
+		return rule, fmt.Errorf("invalid promotion count %q", threshold)
+	}
+	rule.Count = c
+
+	return rule, nil
+}
+
+// Promote replaces prefixes with their covering supernet where the density
+// of listed addresses within that supernet meets the rule. Supernets which
+// overlap any of the protected prefixes are never promoted. The prefixes must
+// be aggregated. Promote returns the aggregated result & the number of
+// supernets promoted.
+func Promote(prefixes []netip.Prefix, rule Promotion, protect []netip.Prefix) ([]netip.Prefix, int) {
+	// a /64 network is larger than any supernet longer than /64
+	size := Size
+	if rule.IPv6 && rule.Bits > 64 {
+		size = func(p netip.Prefix) float64 {
+			return math.Exp2(float64(128 - p.Bits()))
+		}
+	}
+
+	listed := make(map[netip.Prefix]float64)
+	networks := make(map[netip.Prefix]bool)
+	for _, p := range prefixes {
+		if p.Addr().Is6() != rule.IPv6 || p.Bits() <= rule.Bits {
+			continue
+		}
+
+		// IPv6 prefixes within a /64 count as the whole /64 network, once
+		n := size(p)
+		if p.Addr().Is6() && p.Bits() > 64 && rule.Bits <= 64 {
+			network := netip.PrefixFrom(p.Addr(), 64).Masked()
+			if networks[network] {
+				continue
+			}
+			networks[network] = true
+			n = 1
+		}
+		listed[netip.PrefixFrom(p.Addr(), rule.Bits).Masked()] += n
+	}
+
+	protected := newTrie(protect)
+	promoted := make(map[netip.Prefix]bool)
+	for supernet, n := range listed {
+		if rule.Count > 0 && n < rule.Count {
+			continue
+		}
+		if rule.Percent > 0 && n/size(supernet)*100 < rule.Percent {
+			continue
+		}
+		if protected.ContainsAny(supernet) {
+			continue
+		}
+		promoted[supernet] = true
+	}
+
+	if len(promoted) == 0 {
+		return prefixes, 0
+	}
+
+	result := make([]netip.Prefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.Addr().Is6() == rule.IPv6 && p.Bits() > rule.Bits &&
+			promoted[netip.PrefixFrom(p.Addr(), rule.Bits).Masked()] {
+			continue
+		}
+		result = append(result, p)
+	}
+	for supernet := range promoted {
+		result = append(result, supernet)
+	}
+
+	return Aggregate(result), len(promoted)
+}
+
+// Aggregate returns the minimum set of prefixes covering the given prefixes,
+// in canonical order.
+func Aggregate(prefixes []netip.Prefix) []netip.Prefix {
+	result := make([]netip.Prefix, 0, len(prefixes))
+	for _, r := range Merge(prefixes) {
+		result = append(result, r.Prefixes()...)
+	}
+
+	return result
+}
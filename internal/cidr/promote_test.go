@@ -0,0 +1,138 @@
+package cidr
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func mustPrefixes(t *testing.T, entries ...string) []netip.Prefix {
+	t.Helper()
+
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		p, err := Parse(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefixes = append(prefixes, p)
+	}
+
+	return prefixes
+}
+
+func TestParsePromotion(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		ipv6 bool
+		want Promotion
+		err  bool
+	}{
+		{"24:8", false, Promotion{Bits: 24, Count: 8}, false},
+		{"24:10%", false, Promotion{Bits: 24, Percent: 10}, false},
+		{"48:2.5", true, Promotion{IPv6: true, Bits: 48, Count: 2.5}, false},
+		{"120:50%", true, Promotion{IPv6: true, Bits: 120, Percent: 50}, false},
+		{"33:8", false, Promotion{}, true},
+		{"129:8", true, Promotion{}, true},
+		{"-1:8", false, Promotion{}, true},
+		{"24", false, Promotion{}, true},
+		{"24:0", false, Promotion{}, true},
+		{"24:0%", false, Promotion{}, true},
+		{"24:101%", false, Promotion{}, true},
+		{"x:8", false, Promotion{}, true},
+	} {
+		got, err := ParsePromotion(tt.s, tt.ipv6)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParsePromotion(%q) = %+v, want an error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePromotion(%q) = %+v %v, want %+v", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestPromote(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		prefixes []string
+		rule     Promotion
+		protect  []string
+		want     []string
+		promoted int
+	}{
+		{
+			"count",
+			[]string{"1.2.3.1", "1.2.3.5", "1.2.3.9", "1.2.4.1", "1.2.4.5"},
+			Promotion{Bits: 24, Count: 3},
+			nil,
+			[]string{"1.2.3.0/24", "1.2.4.1/32", "1.2.4.5/32"},
+			1,
+		},
+		{
+			"count of addresses not entries",
+			[]string{"1.2.3.0/30", "1.2.4.1"},
+			Promotion{Bits: 24, Count: 4},
+			nil,
+			[]string{"1.2.3.0/24", "1.2.4.1/32"},
+			1,
+		},
+		{
+			"percent",
+			[]string{"1.2.3.0/25", "1.2.4.0/26", "1.2.4.128"},
+			Promotion{Bits: 24, Percent: 50},
+			nil,
+			[]string{"1.2.3.0/24", "1.2.4.0/26", "1.2.4.128/32"},
+			1,
+		},
+		{
+			"protected",
+			[]string{"1.2.3.1", "1.2.3.5", "1.2.3.9", "1.2.5.1", "1.2.5.5", "1.2.5.9"},
+			Promotion{Bits: 24, Count: 3},
+			[]string{"1.2.3.128/32"},
+			[]string{"1.2.3.1/32", "1.2.3.5/32", "1.2.3.9/32", "1.2.5.0/24"},
+			1,
+		},
+		{
+			"shorter prefixes & other family untouched",
+			[]string{"1.2.0.0/16", "2001:db8::1", "2001:db8::2", "2001:db8::3"},
+			Promotion{Bits: 24, Count: 1},
+			nil,
+			[]string{"1.2.0.0/16", "2001:db8::1/128", "2001:db8::2/127"},
+			0,
+		},
+		{
+			"IPv6 /64 networks",
+			[]string{"2001:db8:0:1::1", "2001:db8:0:2::1", "2001:db8:0:3::/64", "2001:db8:1:1::1", "2001:db8:1:1::2", "2001:db8:1:1::3"},
+			Promotion{IPv6: true, Bits: 48, Count: 3},
+			nil,
+			[]string{"2001:db8::/48", "2001:db8:1:1::1/128", "2001:db8:1:1::2/127"},
+			1,
+		},
+		{
+			"IPv6 addresses longer than /64",
+			[]string{"2001:db8::1", "2001:db8::3", "2001:db8::5", "2001:db8::1:1"},
+			Promotion{IPv6: true, Bits: 120, Count: 3},
+			nil,
+			[]string{"2001:db8::/120", "2001:db8::1:1/128"},
+			1,
+		},
+		{
+			"IPv6 percent longer than /64",
+			[]string{"2001:db8::/121", "2001:db8::1:0/122"},
+			Promotion{IPv6: true, Bits: 120, Percent: 50},
+			nil,
+			[]string{"2001:db8::/120", "2001:db8::1:0/122"},
+			1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, promoted := Promote(Aggregate(mustPrefixes(t, tt.prefixes...)), tt.rule, mustPrefixes(t, tt.protect...))
+			if want := mustPrefixes(t, tt.want...); !slices.Equal(got, want) || promoted != tt.promoted {
+				t.Fatalf("Promote() = %v %d, want %v %d", got, promoted, want, tt.promoted)
+			}
+		})
+	}
+}
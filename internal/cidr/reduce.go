@@ -0,0 +1,244 @@
+package cidr
+
+import (
+	"container/heap"
+	"iplists/pkg/iptrie"
+	"math"
+	"net/netip"
+	"slices"
+)
+
+// Cost is the number of additional addresses covered by a lossy reduction.
+// IPv6 is counted in /64 networks.
+type Cost struct {
+	IPv4 float64
+	IPv6 float64
+}
+
+// node is an entry in the linked list of prefixes being reduced
+type node struct {
+	prefix     netip.Prefix
+	prev, next *node
+	dead       bool
+}
+
+// candidate is a possible merge of two adjacent nodes into a supernet
+type candidate struct {
+	left, right *node
+	supernet    netip.Prefix
+	cost        float64
+}
+
+type candidates []candidate
+
+func (c candidates) Len() int { return len(c) }
+func (c candidates) Less(i, j int) bool {
+	if c[i].cost != c[j].cost {
+		return c[i].cost < c[j].cost
+	}
+	return Compare(c[i].supernet, c[j].supernet) < 0
+}
+func (c candidates) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c *candidates) Push(x any)   { *c = append(*c, x.(candidate)) }
+func (c *candidates) Pop() any {
+	old := *c
+	n := len(old)
+	x := old[n-1]
+	*c = old[:n-1]
+	return x
+}
+
+// Reduce greedily merges neighbouring prefixes into supernets until no more
+// than limit entries remain, always choosing the merge which covers the fewest
+// additional addresses. Supernets never overlap any of the protected prefixes.
+// The prefixes must be aggregated & sorted. Reduce returns the resulting
+// prefixes along with the number of additional addresses covered.
+//
+// IPv4 & IPv6 costs aren't comparable, so each family is reduced separately,
+// the limit being split in proportion to their number of entries. Any entries
+// a family can't merge, eg: due to protected prefixes, are taken from the
+// other family's share.
+func Reduce(prefixes []netip.Prefix, limit int, protect []netip.Prefix) ([]netip.Prefix, Cost) {
+	cost := Cost{}
+	if len(prefixes) <= limit || len(prefixes) == 0 {
+		return prefixes, cost
+	}
+
+	protected := newTrie(protect)
+
+	// IPv4 prefixes sort first
+	split := slices.IndexFunc(prefixes, func(p netip.Prefix) bool { return p.Addr().Is6() })
+	if split < 0 {
+		split = len(prefixes)
+	}
+	ipv4, ipv6 := prefixes[:split], prefixes[split:]
+
+	limit4 := limit * len(ipv4) / len(prefixes)
+	ipv4, cost.IPv4 = reduce(ipv4, limit4, protected)
+	ipv6, cost.IPv6 = reduce(ipv6, max(limit-len(ipv4), 0), protected)
+	if len(ipv4)+len(ipv6) > limit {
+		var extra float64
+		ipv4, extra = reduce(ipv4, max(limit-len(ipv6), 0), protected)
+		cost.IPv4 += extra
+	}
+
+	return slices.Concat(ipv4, ipv6), cost
+}
+
+// reduce merges prefixes of a single family until no more than limit entries
+// remain, returning the additional addresses covered.
+func reduce(prefixes []netip.Prefix, limit int, protected *iptrie.Trie[struct{}]) ([]netip.Prefix, float64) {
+	cost := 0.0
+	if len(prefixes) <= limit || len(prefixes) == 0 {
+		return prefixes, cost
+	}
+
+	var head, tail *node
+	for _, p := range prefixes {
+		n := &node{prefix: p, prev: tail}
+		if tail == nil {
+			head = n
+		} else {
+			tail.next = n
+		}
+		tail = n
+	}
+
+	h := &candidates{}
+	for n := head; n.next != nil; n = n.next {
+		if c, ok := newCandidate(n, n.next, protected); ok {
+			*h = append(*h, c)
+		}
+	}
+	heap.Init(h)
+
+	count := len(prefixes)
+	for count > limit && h.Len() > 0 {
+		c := heap.Pop(h).(candidate)
+		if c.left.dead || c.right.dead {
+			continue
+		}
+
+		// neighbouring merges may have lowered the cost since it was queued
+		if fresh, _ := newCandidate(c.left, c.right, protected); fresh.cost != c.cost {
+			heap.Push(h, fresh)
+			continue
+		}
+
+		// absorb every neighbour within the supernet
+		first, last := c.left, c.right
+		for first.prev != nil && c.supernet.Contains(first.prev.prefix.Addr()) {
+			first = first.prev
+		}
+		for last.next != nil && c.supernet.Contains(last.next.prefix.Addr()) {
+			last = last.next
+		}
+
+		merged := &node{prefix: c.supernet, prev: first.prev, next: last.next}
+		for n := first; n != last.next; n = n.next {
+			n.dead = true
+			count--
+		}
+		count++
+
+		if merged.prev == nil {
+			head = merged
+		} else {
+			merged.prev.next = merged
+		}
+		if merged.next != nil {
+			merged.next.prev = merged
+		}
+
+		cost += c.cost
+
+		if merged.prev != nil {
+			if c, ok := newCandidate(merged.prev, merged, protected); ok {
+				heap.Push(h, c)
+			}
+		}
+		if merged.next != nil {
+			if c, ok := newCandidate(merged, merged.next, protected); ok {
+				heap.Push(h, c)
+			}
+		}
+	}
+
+	result := make([]netip.Prefix, 0, count)
+	for n := head; n != nil; n = n.next {
+		result = append(result, n.prefix)
+	}
+
+	// merges may leave supernets which join a neighbour without any cost
+	return Aggregate(result), cost
+}
+
+// newCandidate returns the smallest supernet covering both nodes and the
+// number of additional addresses it would cover.
+func newCandidate(left, right *node, protected *iptrie.Trie[struct{}]) (candidate, bool) {
+	a, b := left.prefix.Addr(), Last(right.prefix)
+	if a.Is4() != b.Is4() {
+		return candidate{}, false
+	}
+
+	bits := min(commonBits(a, b), left.prefix.Bits())
+	supernet := netip.PrefixFrom(a, bits).Masked()
+	if protected.ContainsAny(supernet) {
+		return candidate{}, false
+	}
+
+	covered := 0.0
+	for n := left; n != nil && supernet.Contains(n.prefix.Addr()); n = n.prev {
+		covered += Size(n.prefix)
+	}
+	for n := right; n != nil && supernet.Contains(n.prefix.Addr()); n = n.next {
+		covered += Size(n.prefix)
+	}
+
+	return candidate{
+		left:     left,
+		right:    right,
+		supernet: supernet,
+		cost:     Size(supernet) - covered,
+	}, true
+}
+
+// Size returns the number of addresses in the prefix, or for IPv6
+// the number of /64 networks.
+func Size(p netip.Prefix) float64 {
+	if p.Addr().Is4() {
+		return math.Exp2(float64(32 - p.Bits()))
+	}
+
+	return math.Exp2(float64(64 - p.Bits()))
+}
+
+// newTrie returns a trie of the prefixes for fast lookups.
+func newTrie(prefixes []netip.Prefix) *iptrie.Trie[struct{}] {
+	trie := iptrie.New[struct{}]()
+	for _, p := range prefixes {
+		trie.Insert(p, struct{}{})
+	}
+
+	return trie
+}
+
+// commonBits returns the number of leading bits shared by two addresses.
+func commonBits(a, b netip.Addr) int {
+	x, y := a.AsSlice(), b.AsSlice()
+	bits := 0
+	for i := range x {
+		diff := x[i] ^ y[i]
+		if diff == 0 {
+			bits += 8
+			continue
+		}
+		for diff&0x80 == 0 {
+			bits++
+			diff <<= 1
+		}
+		break
+	}
+
+	return bits
+}
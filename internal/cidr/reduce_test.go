@@ -0,0 +1,142 @@
+package cidr
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestReduce(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		prefixes []string
+		limit    int
+		protect  []string
+		want     []string
+		cost     Cost
+	}{
+		{
+			"under the limit",
+			[]string{"1.0.0.0", "1.0.0.2"},
+			2,
+			nil,
+			[]string{"1.0.0.0", "1.0.0.2"},
+			Cost{},
+		},
+		{
+			"cheapest merge",
+			[]string{"1.0.0.0", "1.0.0.2", "1.0.0.8"},
+			2,
+			nil,
+			[]string{"1.0.0.0/30", "1.0.0.8"},
+			Cost{IPv4: 2},
+		},
+		{
+			"merge absorbs neighbours",
+			[]string{"1.0.0.0", "1.0.0.2", "1.0.0.4/30", "1.0.1.0"},
+			2,
+			nil,
+			[]string{"1.0.0.0/29", "1.0.1.0"},
+			Cost{IPv4: 2},
+		},
+		{
+			"protected",
+			[]string{"1.0.0.0", "1.0.0.2", "1.0.0.8"},
+			2,
+			[]string{"1.0.0.1"},
+			[]string{"1.0.0.0", "1.0.0.2", "1.0.0.8"},
+			Cost{},
+		},
+		{
+			// IPv6 /128s cost a fraction of a /64, but never take the IPv4
+			// share of the limit, which is 2 of 4
+			"families reduced separately",
+			[]string{"1.0.0.0", "1.0.0.2", "1.0.0.4", "1.0.0.6", "2001:db8::", "2001:db8::2", "2001:db8::4", "2001:db8::6"},
+			4,
+			nil,
+			[]string{"1.0.0.0/29", "2001:db8::/126", "2001:db8::4", "2001:db8::6"},
+			Cost{IPv4: 4, IPv6: 2 / 0x1p64},
+		},
+		{
+			"unmergeable family takes the other's share",
+			[]string{"1.0.0.0", "1.0.0.2", "2001:db8::", "2001:db8::2", "2001:db8::4", "2001:db8::6"},
+			4,
+			[]string{"1.0.0.1"},
+			[]string{"1.0.0.0", "1.0.0.2", "2001:db8::/125"},
+			Cost{IPv6: 4 / 0x1p64},
+		},
+		{
+			"IPv6 only",
+			[]string{"2001:db8::/64", "2001:db8:0:2::/64"},
+			1,
+			nil,
+			[]string{"2001:db8::/62"},
+			Cost{IPv6: 2},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cost := Reduce(mustPrefixes(t, tt.prefixes...), tt.limit, mustPrefixes(t, tt.protect...))
+			if want := mustPrefixes(t, tt.want...); !slices.Equal(got, want) || cost != tt.cost {
+				t.Fatalf("Reduce() = %v %+v, want %v %+v", got, cost, want, tt.cost)
+			}
+		})
+	}
+}
+
+// TestReduceInvariants checks random reductions cover every input, stay
+// aggregated & within the limit, never overlap a protected prefix which no
+// input overlaps, and report the cost of each family.
+func TestReduceInvariants(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+
+	for i := range 50 {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			prefixes := Aggregate(randomPrefixes(r, 20+r.IntN(500)))
+			limit := 1 + r.IntN(len(prefixes))
+			protect := []netip.Prefix{}
+			if i%2 == 1 {
+				protect = randomPrefixes(r, 5)
+			}
+
+			got, cost := Reduce(prefixes, limit, protect)
+
+			if len(protect) == 0 && len(got) > limit {
+				t.Fatalf("%d entries, want at most %d", len(got), limit)
+			}
+			if !slices.Equal(Aggregate(got), got) {
+				t.Fatal("result is not aggregated & sorted")
+			}
+
+			trie := newTrie(got)
+			inputs := newTrie(prefixes)
+			size := Cost{}
+			for _, p := range prefixes {
+				if !trie.Covers(p) {
+					t.Fatalf("%s not covered", p)
+				}
+				if p.Addr().Is4() {
+					size.IPv4 -= Size(p)
+				} else {
+					size.IPv6 -= Size(p)
+				}
+			}
+			for _, q := range protect {
+				if !inputs.ContainsAny(q) && trie.ContainsAny(q) {
+					t.Fatalf("protected prefix %s overlapped", q)
+				}
+			}
+			for _, p := range got {
+				if p.Addr().Is4() {
+					size.IPv4 += Size(p)
+				} else {
+					size.IPv6 += Size(p)
+				}
+			}
+			if size != cost {
+				t.Fatalf("cost = %+v, want the added addresses %+v", cost, size)
+			}
+		})
+	}
+}
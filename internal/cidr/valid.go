@@ -0,0 +1,57 @@
+package cidr
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// ReservedPrefixes are the reserved ranges which are never valid list entries.
+// @see https://en.wikipedia.org/wiki/Reserved_IP_addresses
+var ReservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("fc00::/7"),
+}
+
+// Valid checks if the given IP or CIDR is valid and not a reserved address.
+func Valid(ip string) bool {
+	if strings.Contains(ip, "/") {
+		// parse as a CIDR notation
+		parsedIP, _, err := net.ParseCIDR(ip)
+		if err != nil {
+			return false
+		}
+		if parsedIP == nil || reserved(parsedIP) {
+			return false
+		}
+	} else {
+		parsedIP := net.ParseIP(ip)
+		if parsedIP == nil || reserved(parsedIP) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reserved returns whether the IP falls within one of the ReservedPrefixes.
+// Go's IsPrivate() seems to miss a few important entries, namely 127.* and 0.*
+func reserved(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return true
+	}
+	addr = addr.Unmap()
+
+	for _, p := range ReservedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,177 @@
+// Package bots verifies that requests claiming to be from a known crawler, by
+// their User-Agent, come from the IP ranges published for that crawler, and
+// verifies crawler IPs by forward-confirmed reverse DNS.
+package bots
+
+import (
+	"iplists/pkg/lists"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Bot is a known crawler.
+type Bot struct {
+	// Name is the display name of the crawler.
+	Name string
+	// Tokens are case-insensitive substrings identifying the User-Agent.
+	Tokens []string
+	// Lists are the names of the lists of the crawler's published IPs.
+	Lists []string
+	// Domains are the reverse DNS domains of the crawler's hosts, for crawlers
+	// which document forward-confirmed reverse DNS verification.
+	Domains []string
+}
+
+// Known are the crawlers with published IP lists in this repository. More
+// specific tokens are listed before the tokens they contain.
+var Known = []Bot{
+	{
+		Name:    "Google Special Crawler",
+		Tokens:  []string{"adsbot-google", "mediapartners-google", "apis-google", "google-safety"},
+		Lists:   []string{"google-special"},
+		Domains: []string{"google.com"},
+	},
+	{
+		Name:    "Google User-triggered Fetcher",
+		Tokens:  []string{"feedfetcher-google", "google-read-aloud", "google-site-verification", "googleproducer", "google-pagerenderer"},
+		Lists:   []string{"google-fetchers"},
+		Domains: []string{"google.com", "googleusercontent.com"},
+	},
+	{
+		Name:    "Googlebot",
+		Tokens:  []string{"googlebot", "googleother", "google-inspectiontool", "storebot-google", "google-cloudvertexbot"},
+		Lists:   []string{"googlebot"},
+		Domains: []string{"googlebot.com", "google.com"},
+	},
+	{
+		Name:    "Bingbot",
+		Tokens:  []string{"bingbot", "adidxbot", "bingpreview", "msnbot"},
+		Lists:   []string{"bingbot"},
+		Domains: []string{"search.msn.com"},
+	},
+	{
+		Name:    "Applebot",
+		Tokens:  []string{"applebot"},
+		Lists:   []string{"applebot"},
+		Domains: []string{"applebot.apple.com"},
+	},
+	{
+		Name:   "DuckDuckBot",
+		Tokens: []string{"duckduckbot", "duckassistbot"},
+		Lists:  []string{"duckduckbot"},
+	},
+	{
+		Name:   "OpenAI",
+		Tokens: []string{"gptbot", "oai-searchbot", "chatgpt-user"},
+		Lists:  []string{"openai"},
+	},
+	{
+		Name:   "PerplexityBot",
+		Tokens: []string{"perplexitybot"},
+		Lists:  []string{"perplexity-bot"},
+	},
+	{
+		Name:   "Perplexity-User",
+		Tokens: []string{"perplexity-user"},
+		Lists:  []string{"perplexity-user"},
+	},
+	{
+		Name:   "Twitterbot",
+		Tokens: []string{"twitterbot"},
+		Lists:  []string{"twitterbot"},
+	},
+	{
+		Name:   "Facebook Crawler",
+		Tokens: []string{"facebookexternalhit", "facebookcatalog", "meta-externalagent", "meta-externalfetcher"},
+		Lists:  []string{"facebookbot"},
+	},
+	{
+		Name:   "Qwantbot",
+		Tokens: []string{"qwantbot"},
+		Lists:  []string{"qwantbot"},
+	},
+	{
+		Name:    "Yahoo! Slurp",
+		Tokens:  []string{"yahoo! slurp"},
+		Lists:   []string{"yahoo"},
+		Domains: []string{"crawl.yahoo.net"},
+	},
+}
+
+// Verdict is the result of verifying a request.
+type Verdict string
+
+const (
+	// Genuine is a crawler User-Agent from the crawler's published IPs.
+	Genuine Verdict = "genuine"
+	// Spoofed is a crawler User-Agent from any other IP.
+	Spoofed Verdict = "spoofed"
+	// Unknown is a User-Agent of no known crawler, or a crawler without a
+	// loaded list.
+	Unknown Verdict = "unknown"
+)
+
+// Result is the verdict of a request and the crawler it claims to be.
+type Result struct {
+	Verdict Verdict `json:"verdict"`
+	// Bot is the name of the crawler, empty if Unknown.
+	Bot string `json:"bot,omitempty"`
+	// Lists are the names of the crawler's lists containing the IP.
+	Lists []string `json:"lists"`
+}
+
+// Identify returns the known crawler claimed by a User-Agent.
+func Identify(ua string) (Bot, bool) {
+	ua = strings.ToLower(ua)
+	for _, bot := range Known {
+		for _, token := range bot.Tokens {
+			if strings.Contains(ua, token) {
+				return bot, true
+			}
+		}
+	}
+
+	return Bot{}, false
+}
+
+// Verifier verifies requests against the crawler lists.
+type Verifier struct {
+	set *lists.Set
+}
+
+// NewVerifier returns a Verifier using the crawler lists in the set, which may
+// also contain other lists.
+func NewVerifier(set *lists.Set) *Verifier {
+	return &Verifier{set: set}
+}
+
+// Verify returns whether a request from the IP with the User-Agent is from the
+// crawler it claims to be.
+func (v *Verifier) Verify(ua string, addr netip.Addr) Result {
+	bot, ok := Identify(ua)
+	if !ok {
+		return Result{Verdict: Unknown, Lists: []string{}}
+	}
+
+	names := v.set.Names()
+	loaded := slices.ContainsFunc(bot.Lists, func(name string) bool {
+		return slices.Contains(names, name)
+	})
+	if !loaded {
+		return Result{Verdict: Unknown, Bot: bot.Name, Lists: []string{}}
+	}
+
+	matches := []string{}
+	for _, name := range v.set.Lookup(addr) {
+		if slices.Contains(bot.Lists, name) {
+			matches = append(matches, name)
+		}
+	}
+
+	if len(matches) == 0 {
+		return Result{Verdict: Spoofed, Bot: bot.Name, Lists: matches}
+	}
+
+	return Result{Verdict: Genuine, Bot: bot.Name, Lists: matches}
+}
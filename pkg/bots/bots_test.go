@@ -0,0 +1,98 @@
+package bots
+
+import (
+	"iplists/pkg/lists"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestIdentify(t *testing.T) {
+	for _, tt := range []struct {
+		ua   string
+		want string
+	}{
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "Googlebot"},
+		{"Mozilla/5.0 (compatible; GOOGLEBOT/2.1)", "Googlebot"},
+		{"mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)", "Bingbot"},
+		{"Mozilla/5.0 (compatible; Yahoo! Slurp; http://help.yahoo.com/help/us/ysearch/slurp)", "Yahoo! Slurp"},
+		{"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; GPTBot/1.1; +https://openai.com/gptbot)", "OpenAI"},
+		{"Mozilla/5.0 (compatible; Perplexity-User/1.0)", "Perplexity-User"},
+		{"Mozilla/5.0 (compatible; PerplexityBot/1.0)", "PerplexityBot"},
+		// the more specific crawler of several matching tokens
+		{"AdsBot-Google (+http://www.google.com/adsbot.html) Googlebot", "Google Special Crawler"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; bingbot/2.0)", "Googlebot"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0.0.0 Safari/537.36", ""},
+		{"Yahoo Slurp", ""},
+		{"", ""},
+	} {
+		bot, ok := Identify(tt.ua)
+		if ok != (tt.want != "") || bot.Name != tt.want {
+			t.Errorf("Identify(%q) = %q %v, want %q", tt.ua, bot.Name, ok, tt.want)
+		}
+	}
+}
+
+// TestKnownTokens checks tokens are lower case, as User-Agents are matched in
+// lower case, and that no token is shadowed by a token of an earlier crawler.
+func TestKnownTokens(t *testing.T) {
+	for i, bot := range Known {
+		for _, token := range bot.Tokens {
+			if got, _ := Identify(token); got.Name != bot.Name {
+				t.Errorf("token %q of %s identified as %q", token, bot.Name, got.Name)
+			}
+			for _, earlier := range Known[:i] {
+				if slices.Contains(earlier.Tokens, token) {
+					t.Errorf("token %q of %s also belongs to %s", token, bot.Name, earlier.Name)
+				}
+			}
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	set := lists.New()
+	for name, prefix := range map[string]string{
+		"googlebot":      "66.249.64.0/19",
+		"google-special": "66.249.90.0/24",
+		"bingbot":        "157.55.39.0/24",
+		"tor":            "8.8.8.8/32",
+	} {
+		set.AddPrefix(name, netip.MustParsePrefix(prefix))
+	}
+	set.AddPrefix("bingbot", netip.MustParsePrefix("2a01:111:f403::/48"))
+	v := NewVerifier(set)
+
+	const (
+		googlebot = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+		adsbot    = "AdsBot-Google (+http://www.google.com/adsbot.html)"
+		bingbot   = "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)"
+		applebot  = "Mozilla/5.0 (compatible; Applebot/0.1; +http://www.apple.com/go/applebot)"
+		browser   = "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0"
+	)
+
+	for _, tt := range []struct {
+		name string
+		ua   string
+		addr string
+		want Result
+	}{
+		{"genuine", googlebot, "66.249.66.1", Result{Genuine, "Googlebot", []string{"googlebot"}}},
+		{"genuine upper case", "GOOGLEBOT/2.1", "66.249.66.1", Result{Genuine, "Googlebot", []string{"googlebot"}}},
+		{"genuine IPv6", bingbot, "2a01:111:f403::1", Result{Genuine, "Bingbot", []string{"bingbot"}}},
+		{"genuine IPv4-mapped", bingbot, "::ffff:157.55.39.1", Result{Genuine, "Bingbot", []string{"bingbot"}}},
+		{"only the crawler's lists", adsbot, "66.249.90.1", Result{Genuine, "Google Special Crawler", []string{"google-special"}}},
+		{"spoofed", googlebot, "8.8.8.8", Result{Spoofed, "Googlebot", []string{}}},
+		{"spoofed from another crawler", bingbot, "66.249.66.1", Result{Spoofed, "Bingbot", []string{}}},
+		{"spoofed from another list of the same vendor", adsbot, "66.249.66.1", Result{Spoofed, "Google Special Crawler", []string{}}},
+		{"unknown list", applebot, "17.58.101.1", Result{Unknown, "Applebot", []string{}}},
+		{"unknown crawler", browser, "66.249.66.1", Result{Unknown, "", []string{}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := v.Verify(tt.ua, netip.MustParseAddr(tt.addr))
+			if got.Verdict != tt.want.Verdict || got.Bot != tt.want.Bot || !slices.Equal(got.Lists, tt.want.Lists) || got.Lists == nil {
+				t.Fatalf("Verify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
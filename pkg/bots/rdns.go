@@ -0,0 +1,125 @@
+package bots
+
+import (
+	"context"
+	"errors"
+	"iplists/pkg/lists"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// DNSResult is the forward-confirmed reverse DNS verification of an IP.
+type DNSResult struct {
+	IP netip.Addr `json:"ip"`
+	// Host is the verified host name, or the first PTR record if unverified.
+	Host string `json:"host"`
+	// Bots are the names of the crawlers whose domain matches the host.
+	Bots []string `json:"bots"`
+	// Verified is whether the host is in a crawler domain and resolves back
+	// to the IP.
+	Verified bool `json:"verified"`
+	// Listed is whether the IP is in a list of the matching crawlers.
+	Listed bool `json:"listed"`
+}
+
+// Missing returns whether the IP verifies via DNS but is not in the crawler's
+// published list.
+func (r DNSResult) Missing() bool {
+	return r.Verified && !r.Listed
+}
+
+// DNSVerifier verifies crawler IPs by forward-confirmed reverse DNS, the
+// verification method documented by Google, Bing and Apple, among others.
+type DNSVerifier struct {
+	resolver *net.Resolver
+	set      *lists.Set
+}
+
+// NewDNSVerifier returns a DNSVerifier which checks verified IPs against the
+// crawler lists in the set. Queries are sent to the DNS server at address, eg:
+// "127.0.0.1:53", or the system resolver if empty.
+func NewDNSVerifier(set *lists.Set, address string) *DNSVerifier {
+	resolver := net.DefaultResolver
+	if address != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, address)
+			},
+		}
+	}
+
+	return &DNSVerifier{resolver: resolver, set: set}
+}
+
+// Verify performs a PTR lookup of the IP, and for every host in a crawler
+// domain, a forward lookup to confirm the host resolves back to the IP. An IP
+// without PTR records is unverified rather than an error.
+func (v *DNSVerifier) Verify(ctx context.Context, addr netip.Addr) (DNSResult, error) {
+	addr = addr.Unmap()
+	result := DNSResult{IP: addr, Bots: []string{}}
+
+	hosts, err := v.resolver.LookupAddr(ctx, addr.String())
+	if err != nil && !notFound(err) {
+		return result, err
+	}
+
+	for _, host := range hosts {
+		host = strings.TrimSuffix(strings.ToLower(host), ".")
+		if result.Host == "" {
+			result.Host = host
+		}
+
+		matching := DomainBots(host)
+		if len(matching) == 0 {
+			continue
+		}
+
+		addrs, err := v.resolver.LookupNetIP(ctx, "ip", host)
+		if err != nil && !notFound(err) {
+			return result, err
+		}
+		if !slices.ContainsFunc(addrs, func(a netip.Addr) bool { return a.Unmap() == addr }) {
+			continue
+		}
+
+		result.Host = host
+		result.Verified = true
+		listed := v.set.Lookup(addr)
+		for _, bot := range matching {
+			result.Bots = append(result.Bots, bot.Name)
+			if slices.ContainsFunc(bot.Lists, func(name string) bool {
+				return slices.Contains(listed, name)
+			}) {
+				result.Listed = true
+			}
+		}
+		break
+	}
+
+	return result, nil
+}
+
+// DomainBots returns the known crawlers whose reverse DNS domains contain
+// the host.
+func DomainBots(host string) []Bot {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	matching := []Bot{}
+	for _, bot := range Known {
+		if slices.ContainsFunc(bot.Domains, func(domain string) bool {
+			return strings.HasSuffix(host, "."+domain)
+		}) {
+			matching = append(matching, bot)
+		}
+	}
+
+	return matching
+}
+
+func notFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
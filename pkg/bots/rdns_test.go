@@ -0,0 +1,217 @@
+package bots
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"iplists/pkg/lists"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	typeA    = 1
+	typePTR  = 12
+	typeAAAA = 28
+)
+
+// records are the answers of the stub DNS server by type & name, names are
+// lower case and fully qualified.
+type records map[uint16]map[string][]string
+
+// serveDNS starts a DNS server on a local UDP port answering from the
+// records, NXDOMAIN for names without records of any type, and returns its
+// address.
+func serveDNS(t *testing.T, rrs records) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := answer(buf[:n], rrs); resp != nil {
+				_, _ = conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+// answer returns the response to a query of a single question.
+func answer(query []byte, rrs records) []byte {
+	if len(query) < 12 || binary.BigEndian.Uint16(query[4:]) != 1 {
+		return nil
+	}
+
+	labels := []string{}
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		end := i + 1 + int(query[i])
+		if end > len(query) {
+			return nil
+		}
+		labels = append(labels, strings.ToLower(string(query[i+1:end])))
+		i = end
+	}
+	if i+5 > len(query) {
+		return nil
+	}
+	name := strings.Join(labels, ".") + "."
+	qtype := binary.BigEndian.Uint16(query[i+1:])
+	question := query[12 : i+5]
+
+	values := rrs[qtype][name]
+	flags := uint16(0x8180) // response, recursion desired & available
+	if values == nil && rrs[typeA][name] == nil && rrs[typeAAAA][name] == nil && rrs[typePTR][name] == nil {
+		flags |= 3 // NXDOMAIN
+	}
+
+	resp := binary.BigEndian.AppendUint16(nil, binary.BigEndian.Uint16(query))
+	resp = binary.BigEndian.AppendUint16(resp, flags)
+	resp = binary.BigEndian.AppendUint16(resp, 1)
+	resp = binary.BigEndian.AppendUint16(resp, uint16(len(values)))
+	resp = binary.BigEndian.AppendUint32(resp, 0)
+	resp = append(resp, question...)
+
+	for _, value := range values {
+		var rdata []byte
+		switch qtype {
+		case typePTR:
+			for label := range strings.SplitSeq(strings.TrimSuffix(value, "."), ".") {
+				rdata = append(append(rdata, byte(len(label))), label...)
+			}
+			rdata = append(rdata, 0)
+		default:
+			rdata = netip.MustParseAddr(value).AsSlice()
+		}
+
+		resp = binary.BigEndian.AppendUint16(resp, 0xc00c) // question name
+		resp = binary.BigEndian.AppendUint16(resp, qtype)
+		resp = binary.BigEndian.AppendUint16(resp, 1)
+		resp = binary.BigEndian.AppendUint32(resp, 60)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(rdata)))
+		resp = append(resp, rdata...)
+	}
+
+	return resp
+}
+
+// reverse returns the PTR query name of an IP.
+func reverse(addr string) string {
+	a := netip.MustParseAddr(addr)
+	if a.Is4() {
+		b := a.As4()
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", b[3], b[2], b[1], b[0])
+	}
+
+	const hex = "0123456789abcdef"
+	nibbles := []string{}
+	ip := a.As16()
+	for _, b := range slices.Backward(ip[:]) {
+		nibbles = append(nibbles, string(hex[b&0xf]), string(hex[b>>4]))
+	}
+
+	return strings.Join(nibbles, ".") + ".ip6.arpa."
+}
+
+func TestDNSVerifierVerify(t *testing.T) {
+	address := serveDNS(t, records{
+		typePTR: {
+			reverse("192.0.2.1"):   {"crawl-192-0-2-1.googlebot.com."},
+			reverse("192.0.2.2"):   {"crawl-192-0-2-2.googlebot.com."},
+			reverse("192.0.2.3"):   {"host.example.com."},
+			reverse("192.0.2.5"):   {"googlebot.com.example.com."},
+			reverse("192.0.2.6"):   {"other.example.com.", "Crawl-192-0-2-6.GoogleBot.com."},
+			reverse("2001:db8::1"): {"msnbot-2001-db8--1.search.msn.com."},
+		},
+		typeA: {
+			"crawl-192-0-2-1.googlebot.com.": {"192.0.2.1"},
+			"crawl-192-0-2-2.googlebot.com.": {"198.51.100.2"},
+			"googlebot.com.example.com.":     {"192.0.2.5"},
+			"crawl-192-0-2-6.googlebot.com.": {"192.0.2.6"},
+		},
+		typeAAAA: {
+			"msnbot-2001-db8--1.search.msn.com.": {"2001:db8::1"},
+		},
+	})
+
+	set := lists.New()
+	set.AddPrefix("googlebot", netip.MustParsePrefix("192.0.2.0/24"))
+	verifier := NewDNSVerifier(set, address)
+
+	for _, tt := range []struct {
+		ip   string
+		want DNSResult
+	}{
+		// forward-confirmed & listed
+		{"192.0.2.1", DNSResult{Host: "crawl-192-0-2-1.googlebot.com", Bots: []string{"Googlebot"}, Verified: true, Listed: true}},
+		// the host resolves to another IP
+		{"192.0.2.2", DNSResult{Host: "crawl-192-0-2-2.googlebot.com", Bots: []string{}}},
+		// not a crawler domain
+		{"192.0.2.3", DNSResult{Host: "host.example.com", Bots: []string{}}},
+		// no PTR record
+		{"192.0.2.4", DNSResult{Bots: []string{}}},
+		// a crawler domain as a subdomain of another domain
+		{"192.0.2.5", DNSResult{Host: "googlebot.com.example.com", Bots: []string{}}},
+		// the crawler host is not the first PTR record
+		{"192.0.2.6", DNSResult{Host: "crawl-192-0-2-6.googlebot.com", Bots: []string{"Googlebot"}, Verified: true, Listed: true}},
+		// forward-confirmed but missing from the list
+		{"2001:db8::1", DNSResult{Host: "msnbot-2001-db8--1.search.msn.com", Bots: []string{"Bingbot"}, Verified: true}},
+		// IPv4-mapped IPv6 addresses are verified as IPv4
+		{"::ffff:192.0.2.1", DNSResult{Host: "crawl-192-0-2-1.googlebot.com", Bots: []string{"Googlebot"}, Verified: true, Listed: true}},
+	} {
+		t.Run(tt.ip, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			got, err := verifier.Verify(ctx, netip.MustParseAddr(tt.ip))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.want.IP = netip.MustParseAddr(tt.ip).Unmap()
+			if got.IP != tt.want.IP || got.Host != tt.want.Host || !slices.Equal(got.Bots, tt.want.Bots) ||
+				got.Verified != tt.want.Verified || got.Listed != tt.want.Listed {
+				t.Fatalf("Verify(%s) = %+v, want %+v", tt.ip, got, tt.want)
+			}
+			if got.Missing() != (tt.want.Verified && !tt.want.Listed) {
+				t.Fatalf("Missing() = %v", got.Missing())
+			}
+		})
+	}
+}
+
+func TestDomainBots(t *testing.T) {
+	for _, tt := range []struct {
+		host string
+		want []string
+	}{
+		{"crawl-66-249-66-1.googlebot.com.", []string{"Googlebot"}},
+		{"rate-limited-proxy-66-249-90-77.google.com", []string{"Google Special Crawler", "Google User-triggered Fetcher", "Googlebot"}},
+		{"MSNBOT-40-77-167-1.SEARCH.MSN.COM", []string{"Bingbot"}},
+		{"googlebot.com", []string{}},
+		{"evilgooglebot.com", []string{}},
+	} {
+		got := []string{}
+		for _, bot := range DomainBots(tt.host) {
+			got = append(got, bot.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("DomainBots(%s) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+// Package iptrie provides a compressed radix tree of IPv4 & IPv6 prefixes
+// for fast membership queries.
+package iptrie
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net/netip"
+)
+
+// Trie is a compressed (path-compressed binary radix) tree mapping IP prefixes
+// to values. The zero value is an empty trie ready to use. A Trie is not safe
+// for concurrent modification, but may be read concurrently.
+type Trie[T any] struct {
+	v4, v6 *node[T]
+	size   int
+}
+
+// Entry is a prefix and its value.
+type Entry[T any] struct {
+	Prefix netip.Prefix
+	Value  T
+}
+
+type node[T any] struct {
+	prefix   netip.Prefix
+	value    T
+	hasValue bool
+	children [2]*node[T]
+}
+
+// New returns an empty trie.
+func New[T any]() *Trie[T] {
+	return &Trie[T]{}
+}
+
+// Len returns the number of prefixes in the trie.
+func (t *Trie[T]) Len() int {
+	return t.size
+}
+
+// Insert adds a prefix to the trie, replacing the value of an existing prefix.
+// Host bits of the prefix are ignored.
+func (t *Trie[T]) Insert(p netip.Prefix, v T) {
+	p, ok := normalize(p)
+	if !ok {
+		return
+	}
+
+	root := t.root(p.Addr())
+	*root = t.insert(*root, p, v)
+}
+
+func (t *Trie[T]) insert(n *node[T], p netip.Prefix, v T) *node[T] {
+	if n == nil {
+		t.size++
+		return &node[T]{prefix: p, value: v, hasValue: true}
+	}
+
+	common := commonBits(n.prefix, p)
+
+	switch {
+	case common == n.prefix.Bits() && common == p.Bits():
+		// same prefix
+		if !n.hasValue {
+			t.size++
+		}
+		n.value, n.hasValue = v, true
+		return n
+	case common == n.prefix.Bits():
+		// n contains p
+		b := bit(p.Addr(), common)
+		n.children[b] = t.insert(n.children[b], p, v)
+		return n
+	case common == p.Bits():
+		// p contains n
+		t.size++
+		parent := &node[T]{prefix: p, value: v, hasValue: true}
+		parent.children[bit(n.prefix.Addr(), common)] = n
+		return parent
+	default:
+		// p & n diverge, join them under their common prefix
+		t.size++
+		leaf := &node[T]{prefix: p, value: v, hasValue: true}
+		parent := &node[T]{prefix: netip.PrefixFrom(p.Addr(), common).Masked()}
+		parent.children[bit(p.Addr(), common)] = leaf
+		parent.children[bit(n.prefix.Addr(), common)] = n
+		return parent
+	}
+}
+
+// Get returns the value of an exact prefix.
+func (t *Trie[T]) Get(p netip.Prefix) (T, bool) {
+	var zero T
+	p, ok := normalize(p)
+	if !ok {
+		return zero, false
+	}
+
+	for n := *t.root(p.Addr()); n != nil && n.prefix.Bits() <= p.Bits(); {
+		if !n.prefix.Contains(p.Addr()) {
+			break
+		}
+		if n.prefix.Bits() == p.Bits() {
+			return n.value, n.hasValue
+		}
+		n = n.children[bit(p.Addr(), n.prefix.Bits())]
+	}
+
+	return zero, false
+}
+
+// Delete removes an exact prefix from the trie, returning whether it existed.
+func (t *Trie[T]) Delete(p netip.Prefix) bool {
+	p, ok := normalize(p)
+	if !ok {
+		return false
+	}
+
+	root := t.root(p.Addr())
+	var deleted bool
+	*root, deleted = t.delete(*root, p)
+
+	return deleted
+}
+
+func (t *Trie[T]) delete(n *node[T], p netip.Prefix) (*node[T], bool) {
+	if n == nil || n.prefix.Bits() > p.Bits() || !n.prefix.Contains(p.Addr()) {
+		return n, false
+	}
+
+	if n.prefix.Bits() < p.Bits() {
+		b := bit(p.Addr(), n.prefix.Bits())
+		child, deleted := t.delete(n.children[b], p)
+		n.children[b] = child
+		if deleted && !n.hasValue {
+			// an intermediate node is only required to join two children
+			return compact(n), true
+		}
+		return n, deleted
+	}
+
+	if !n.hasValue {
+		return n, false
+	}
+
+	t.size--
+	var zero T
+	n.value, n.hasValue = zero, false
+
+	return compact(n), true
+}
+
+// compact removes a valueless node with fewer than two children.
+func compact[T any](n *node[T]) *node[T] {
+	switch {
+	case n.children[0] != nil && n.children[1] != nil:
+		return n
+	case n.children[0] != nil:
+		return n.children[0]
+	default:
+		return n.children[1]
+	}
+}
+
+// Lookup returns the longest prefix containing the address, and its value.
+func (t *Trie[T]) Lookup(addr netip.Addr) (netip.Prefix, T, bool) {
+	var (
+		match netip.Prefix
+		value T
+		found bool
+	)
+
+	addr = addr.Unmap().WithZone("")
+	for n := *t.root(addr); n != nil && n.prefix.Contains(addr); {
+		if n.hasValue {
+			match, value, found = n.prefix, n.value, true
+		}
+		if n.prefix.Bits() == addr.BitLen() {
+			break
+		}
+		n = n.children[bit(addr, n.prefix.Bits())]
+	}
+
+	return match, value, found
+}
+
+// Contains returns whether any prefix in the trie contains the address.
+func (t *Trie[T]) Contains(addr netip.Addr) bool {
+	_, _, found := t.Lookup(addr)
+	return found
+}
+
+// Covers returns whether any prefix in the trie contains the whole given
+// prefix, ie: is the same or shorter.
+func (t *Trie[T]) Covers(p netip.Prefix) bool {
+	p, ok := normalize(p)
+	if !ok {
+		return false
+	}
+
+	for n := *t.root(p.Addr()); n != nil && n.prefix.Bits() <= p.Bits(); {
+		if !n.prefix.Contains(p.Addr()) {
+			break
+		}
+		if n.hasValue {
+			return true
+		}
+		if n.prefix.Bits() == p.Bits() {
+			break
+		}
+		n = n.children[bit(p.Addr(), n.prefix.Bits())]
+	}
+
+	return false
+}
+
+// ContainsAny returns whether any prefix in the trie overlaps the given prefix,
+// ie: contains it or is contained by it.
+func (t *Trie[T]) ContainsAny(p netip.Prefix) bool {
+	found := false
+	t.overlaps(p, func(netip.Prefix, T) bool {
+		found = true
+		return false
+	})
+
+	return found
+}
+
+// Overlaps returns every prefix in the trie which overlaps the given prefix,
+// ie: the prefixes containing it followed by those it contains.
+func (t *Trie[T]) Overlaps(p netip.Prefix) []Entry[T] {
+	entries := []Entry[T]{}
+	t.overlaps(p, func(prefix netip.Prefix, v T) bool {
+		entries = append(entries, Entry[T]{Prefix: prefix, Value: v})
+		return true
+	})
+
+	return entries
+}
+
+func (t *Trie[T]) overlaps(p netip.Prefix, fn func(netip.Prefix, T) bool) {
+	p, ok := normalize(p)
+	if !ok {
+		return
+	}
+
+	n := *t.root(p.Addr())
+	for n != nil && n.prefix.Bits() < p.Bits() {
+		if !n.prefix.Contains(p.Addr()) {
+			return
+		}
+		if n.hasValue && !fn(n.prefix, n.value) {
+			return
+		}
+		n = n.children[bit(p.Addr(), n.prefix.Bits())]
+	}
+
+	// n is now the first node at least as long as p
+	if n != nil && p.Contains(n.prefix.Addr()) {
+		walk(n, fn)
+	}
+}
+
+// Walk calls fn for every prefix in canonical order (IPv4 before IPv6, then
+// by address, with containing prefixes first) until fn returns false.
+func (t *Trie[T]) Walk(fn func(netip.Prefix, T) bool) {
+	if walk(t.v4, fn) {
+		walk(t.v6, fn)
+	}
+}
+
+// walk visits the subtree in order, returning false if stopped by fn.
+func walk[T any](n *node[T], fn func(netip.Prefix, T) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.hasValue && !fn(n.prefix, n.value) {
+		return false
+	}
+
+	return walk(n.children[0], fn) && walk(n.children[1], fn)
+}
+
+func (t *Trie[T]) root(addr netip.Addr) **node[T] {
+	if addr.Is4() {
+		return &t.v4
+	}
+
+	return &t.v6
+}
+
+// normalize masks the prefix, treating IPv4-mapped IPv6 prefixes as IPv4.
+func normalize(p netip.Prefix) (netip.Prefix, bool) {
+	if !p.IsValid() {
+		return p, false
+	}
+
+	addr := p.Addr()
+	if addr.Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(addr.Unmap(), p.Bits()-96)
+	}
+
+	return netip.PrefixFrom(p.Addr().WithZone(""), p.Bits()).Masked(), true
+}
+
+// bit returns bit i of the address, counting from the most significant bit.
+func bit(addr netip.Addr, i int) int {
+	if addr.Is4() {
+		b := addr.As4()
+		return int(b[i/8]>>(7-i%8)) & 1
+	}
+
+	b := addr.As16()
+
+	return int(b[i/8]>>(7-i%8)) & 1
+}
+
+// commonBits returns the length of the longest prefix shared by two prefixes.
+func commonBits(a, b netip.Prefix) int {
+	x, y := a.Addr().As16(), b.Addr().As16()
+
+	common := 0
+	if d := binary.BigEndian.Uint64(x[:8]) ^ binary.BigEndian.Uint64(y[:8]); d != 0 {
+		common = bits.LeadingZeros64(d)
+	} else {
+		common = 64 + bits.LeadingZeros64(binary.BigEndian.Uint64(x[8:])^binary.BigEndian.Uint64(y[8:]))
+	}
+
+	if a.Addr().Is4() {
+		// As16 returns IPv4 addresses in their mapped form
+		common -= 96
+	}
+
+	return min(common, a.Bits(), b.Bits())
+}
@@ -0,0 +1,211 @@
+package iptrie
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+// randomPrefix returns a prefix within 10.0.0.0/16 or 2001:db8::/112, so
+// prefixes often overlap.
+func randomPrefix(r *rand.Rand) netip.Prefix {
+	if r.IntN(2) == 0 {
+		addr := netip.AddrFrom4([4]byte{10, 0, byte(r.IntN(256)), byte(r.IntN(256))})
+		return netip.PrefixFrom(addr, 14+r.IntN(19)).Masked()
+	}
+
+	b := netip.MustParseAddr("2001:db8::").As16()
+	b[14], b[15] = byte(r.IntN(256)), byte(r.IntN(256))
+
+	return netip.PrefixFrom(netip.AddrFrom16(b), 110+r.IntN(19)).Masked()
+}
+
+// model is a brute force implementation of the trie operations.
+type model map[netip.Prefix]int
+
+func (m model) lookup(addr netip.Addr) (netip.Prefix, int, bool) {
+	var (
+		match netip.Prefix
+		value int
+		found bool
+	)
+	for p, v := range m {
+		if p.Contains(addr) && (!found || p.Bits() > match.Bits()) {
+			match, value, found = p, v, true
+		}
+	}
+
+	return match, value, found
+}
+
+func (m model) overlaps(q netip.Prefix) []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	for p := range m {
+		if p.Overlaps(q) {
+			prefixes = append(prefixes, p)
+		}
+	}
+
+	return prefixes
+}
+
+func (m model) covers(q netip.Prefix) bool {
+	for p := range m {
+		if p.Bits() <= q.Bits() && p.Contains(q.Addr()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func comparePrefixes(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+
+	return a.Bits() - b.Bits()
+}
+
+func TestTrieMatchesModel(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	trie := New[int]()
+	m := model{}
+
+	for i := range 5000 {
+		p := randomPrefix(r)
+		if r.IntN(3) == 0 {
+			_, exists := m[p]
+			if deleted := trie.Delete(p); deleted != exists {
+				t.Fatalf("Delete(%s) = %v, want %v", p, deleted, exists)
+			}
+			delete(m, p)
+		} else {
+			trie.Insert(p, i)
+			m[p] = i
+		}
+
+		if trie.Len() != len(m) {
+			t.Fatalf("Len() = %d, want %d", trie.Len(), len(m))
+		}
+
+		q := randomPrefix(r)
+		wantGet, exists := m[q]
+		if got, ok := trie.Get(q); ok != exists || got != wantGet {
+			t.Fatalf("Get(%s) = %d %v, want %d %v", q, got, ok, wantGet, exists)
+		}
+
+		addr := q.Addr()
+		wantPrefix, wantValue, wantFound := m.lookup(addr)
+		gotPrefix, gotValue, gotFound := trie.Lookup(addr)
+		if gotPrefix != wantPrefix || gotValue != wantValue || gotFound != wantFound {
+			t.Fatalf("Lookup(%s) = %s %d %v, want %s %d %v", addr, gotPrefix, gotValue, gotFound, wantPrefix, wantValue, wantFound)
+		}
+
+		want := m.overlaps(q)
+		got := []netip.Prefix{}
+		for _, e := range trie.Overlaps(q) {
+			got = append(got, e.Prefix)
+			if e.Value != m[e.Prefix] {
+				t.Fatalf("Overlaps(%s) value of %s = %d, want %d", q, e.Prefix, e.Value, m[e.Prefix])
+			}
+		}
+		slices.SortFunc(got, comparePrefixes)
+		slices.SortFunc(want, comparePrefixes)
+		if !slices.Equal(got, want) {
+			t.Fatalf("Overlaps(%s) = %v, want %v", q, got, want)
+		}
+
+		if got, want := trie.ContainsAny(q), len(want) > 0; got != want {
+			t.Fatalf("ContainsAny(%s) = %v, want %v", q, got, want)
+		}
+		if got, want := trie.Covers(q), m.covers(q); got != want {
+			t.Fatalf("Covers(%s) = %v, want %v", q, got, want)
+		}
+	}
+
+	walked := []netip.Prefix{}
+	trie.Walk(func(p netip.Prefix, v int) bool {
+		if v != m[p] {
+			t.Fatalf("Walk value of %s = %d, want %d", p, v, m[p])
+		}
+		walked = append(walked, p)
+		return true
+	})
+	if !slices.IsSortedFunc(walked, comparePrefixes) || len(walked) != len(m) {
+		t.Fatalf("Walk visited %d prefixes out of order, want %d", len(walked), len(m))
+	}
+}
+
+func TestCovers(t *testing.T) {
+	trie := New[struct{}]()
+	trie.Insert(netip.MustParsePrefix("10.0.0.0/32"), struct{}{})
+	trie.Insert(netip.MustParsePrefix("192.168.0.0/16"), struct{}{})
+
+	for _, tt := range []struct {
+		prefix string
+		want   bool
+	}{
+		{"10.0.0.0/8", false},
+		{"10.0.0.0/32", true},
+		{"192.168.1.0/24", true},
+		{"192.168.0.0/15", false},
+		{"::ffff:192.168.1.1/128", true},
+	} {
+		if got := trie.Covers(netip.MustParsePrefix(tt.prefix)); got != tt.want {
+			t.Errorf("Covers(%s) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+// benchPrefixes returns n random IPv4 prefixes of /16 to /32.
+func benchPrefixes(n int, seed uint64) []netip.Prefix {
+	r := rand.New(rand.NewPCG(seed, 2))
+	prefixes := make([]netip.Prefix, n)
+	for i := range prefixes {
+		addr := netip.AddrFrom4([4]byte{byte(r.IntN(256)), byte(r.IntN(256)), byte(r.IntN(256)), byte(r.IntN(256))})
+		prefixes[i] = netip.PrefixFrom(addr, 16+r.IntN(17)).Masked()
+	}
+
+	return prefixes
+}
+
+func benchTrie(prefixes []netip.Prefix) *Trie[struct{}] {
+	trie := New[struct{}]()
+	for _, p := range prefixes {
+		trie.Insert(p, struct{}{})
+	}
+
+	return trie
+}
+
+func BenchmarkInsert(b *testing.B) {
+	prefixes := benchPrefixes(100000, 1)
+
+	for b.Loop() {
+		benchTrie(prefixes)
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	trie := benchTrie(benchPrefixes(100000, 1))
+	queries := benchPrefixes(1024, 3)
+
+	i := 0
+	for b.Loop() {
+		trie.Lookup(queries[i%len(queries)].Addr())
+		i++
+	}
+}
+
+func BenchmarkContainsAny(b *testing.B) {
+	trie := benchTrie(benchPrefixes(100000, 1))
+	queries := benchPrefixes(1024, 3)
+
+	i := 0
+	for b.Loop() {
+		trie.ContainsAny(queries[i%len(queries)])
+		i++
+	}
+}
@@ -0,0 +1,187 @@
+// Package lists loads and queries the IP lists in this repository.
+//
+// A list is a plain text file of IPs & CIDRs, one per line, and is identified
+// by its file name without the ".txt" extension, eg: "lists/googlebot.txt" is
+// named "googlebot". Invalid and reserved (private, loopback etc) entries are
+// ignored, in the same way as they are when the lists are generated.
+package lists
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iplists/internal/cidr"
+	"iplists/pkg/iptrie"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Match is a list entry matching a query.
+type Match struct {
+	List   string       `json:"list"`
+	Prefix netip.Prefix `json:"prefix"`
+}
+
+// Set is a collection of named lists which can be queried by address.
+// A Set is safe for concurrent reads once loaded, but lists must not be added
+// while it is being read: replace the Set to reload lists.
+type Set struct {
+	// Reserved keeps reserved entries, which are otherwise ignored, when
+	// adding lists, eg: lists of internal proxies.
+	Reserved bool
+
+	// trie maps every list entry to the names of the lists containing it
+	trie  iptrie.Trie[[]string]
+	names []string
+}
+
+// New returns an empty Set.
+func New() *Set {
+	return &Set{}
+}
+
+// Load returns a Set of one or more list files.
+func Load(files ...string) (*Set, error) {
+	s := New()
+	for _, file := range files {
+		if err := s.AddFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// LoadDir returns a Set of every list (*.txt) in a directory.
+func LoadDir(dir string) (*Set, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(files...)
+}
+
+// Name returns the list name of a file, its base name without the extension.
+func Name(file string) string {
+	return strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+}
+
+// AddFile adds a list file to the Set, named after the file.
+func (s *Set) AddFile(file string) error {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := s.Add(Name(file), f); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	return nil
+}
+
+// Add reads a list of IPs & CIDRs, one per line, and adds it to the Set under
+// the given name. Adding the same name again extends the list.
+func (s *Set) Add(name string, r io.Reader) error {
+	s.addName(name)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		p, err := cidr.Parse(line)
+		if err != nil || (!s.Reserved && !cidr.Valid(line)) {
+			continue
+		}
+
+		s.AddPrefix(name, p)
+	}
+
+	return scanner.Err()
+}
+
+// AddPrefix adds a single prefix to the named list.
+func (s *Set) AddPrefix(name string, p netip.Prefix) {
+	s.addName(name)
+
+	names, _ := s.trie.Get(p)
+	if slices.Contains(names, name) {
+		return
+	}
+
+	names = append(names, name)
+	slices.Sort(names)
+	s.trie.Insert(p, names)
+}
+
+// addName adds a list name to the Set, if not already added.
+func (s *Set) addName(name string) {
+	if !slices.Contains(s.names, name) {
+		s.names = append(s.names, name)
+		slices.Sort(s.names)
+	}
+}
+
+// Names returns the sorted names of all lists in the Set.
+func (s *Set) Names() []string {
+	return slices.Clone(s.names)
+}
+
+// Len returns the number of unique entries in the Set.
+func (s *Set) Len() int {
+	return s.trie.Len()
+}
+
+// Contains returns whether any list contains the address.
+func (s *Set) Contains(addr netip.Addr) bool {
+	return s.trie.Contains(addr)
+}
+
+// Lookup returns the sorted names of the lists containing the address.
+func (s *Set) Lookup(addr netip.Addr) []string {
+	addr = addr.Unmap()
+	names := []string{}
+	for _, e := range s.trie.Overlaps(netip.PrefixFrom(addr, addr.BitLen())) {
+		for _, name := range e.Value {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// Matches returns every list entry overlapping the prefix, ie: containing it
+// or contained by it, ordered by entry and then list name.
+func (s *Set) Matches(p netip.Prefix) []Match {
+	matches := []Match{}
+	for _, e := range s.trie.Overlaps(p) {
+		for _, name := range e.Value {
+			matches = append(matches, Match{List: name, Prefix: e.Prefix})
+		}
+	}
+
+	return matches
+}
+
+// Prefixes returns the minimum set of prefixes covering the named lists, or
+// all lists if no names are given, in canonical order.
+func (s *Set) Prefixes(names ...string) []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	s.trie.Walk(func(p netip.Prefix, lists []string) bool {
+		if len(names) == 0 || slices.ContainsFunc(lists, func(name string) bool {
+			return slices.Contains(names, name)
+		}) {
+			prefixes = append(prefixes, p)
+		}
+		return true
+	})
+
+	return cidr.Aggregate(prefixes)
+}
@@ -0,0 +1,203 @@
+package lists
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testSet returns a Set of the lists "bad" and "tor", sharing 1.1.1.1.
+func testSet(t *testing.T) *Set {
+	t.Helper()
+
+	s := New()
+	for name, content := range map[string]string{
+		"bad": "1.1.1.0/24\n2606:4700::/32\n",
+		"tor": "1.1.1.1\n8.8.8.8\n",
+	} {
+		if err := s.Add(name, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s
+}
+
+func TestAdd(t *testing.T) {
+	content := "1.1.1.1\n  8.8.8.0/24  \n\n# comment\nbogus\n10.0.0.0/8\n192.168.1.1\n127.0.0.1\nfd00::1\n1.1.1.1\n"
+
+	s := New()
+	if err := s.Add("bad", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Prefixes(); !slices.Equal(got, mustPrefixes("1.1.1.1/32", "8.8.8.0/24")) {
+		t.Errorf("Prefixes() = %v, want invalid, reserved & duplicate entries ignored", got)
+	}
+
+	reserved := New()
+	reserved.Reserved = true
+	if err := reserved.Add("proxies", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reserved.Len(), 6; got != want {
+		t.Errorf("Len() with Reserved = %d, want %d", got, want)
+	}
+
+	// adding a name again extends the list
+	if err := s.Add("bad", strings.NewReader("9.9.9.9\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Contains(netip.MustParseAddr("9.9.9.9")) || !s.Contains(netip.MustParseAddr("1.1.1.1")) || s.Len() != 3 {
+		t.Errorf("Add() of an existing name = %v, want the list extended", s.Prefixes())
+	}
+	if got := s.Names(); !slices.Equal(got, []string{"bad"}) {
+		t.Errorf("Names() = %v, want [bad]", got)
+	}
+}
+
+func TestAddPrefix(t *testing.T) {
+	s := New()
+	p := netip.MustParsePrefix("10.0.0.0/8")
+	s.AddPrefix("tor", p)
+	s.AddPrefix("bad", p)
+	s.AddPrefix("bad", p)
+
+	// reserved prefixes aren't ignored
+	if got := s.Lookup(netip.MustParseAddr("10.1.2.3")); !slices.Equal(got, []string{"bad", "tor"}) {
+		t.Errorf("Lookup() = %v, want [bad tor]", got)
+	}
+	if got := s.Matches(p); len(got) != 2 {
+		t.Errorf("Matches() = %v, want a match per list", got)
+	}
+	if s.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", s.Len())
+	}
+	if got := s.Names(); !slices.Equal(got, []string{"bad", "tor"}) {
+		t.Errorf("Names() = %v, want [bad tor]", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	s := testSet(t)
+
+	for _, tt := range []struct {
+		addr string
+		want []string
+	}{
+		{"1.1.1.1", []string{"bad", "tor"}},
+		{"1.1.1.2", []string{"bad"}},
+		{"::ffff:1.1.1.1", []string{"bad", "tor"}},
+		{"8.8.8.8", []string{"tor"}},
+		{"2606:4700::1", []string{"bad"}},
+		{"9.9.9.9", []string{}},
+	} {
+		addr := netip.MustParseAddr(tt.addr)
+		if got := s.Lookup(addr); !slices.Equal(got, tt.want) {
+			t.Errorf("Lookup(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+		if got := s.Contains(addr.Unmap()); got != (len(tt.want) > 0) {
+			t.Errorf("Contains(%s) = %v, want %v", tt.addr, got, len(tt.want) > 0)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	s := testSet(t)
+
+	for _, tt := range []struct {
+		prefix string
+		want   []Match
+	}{
+		{"1.1.1.1/32", []Match{
+			{"bad", netip.MustParsePrefix("1.1.1.0/24")},
+			{"tor", netip.MustParsePrefix("1.1.1.1/32")},
+		}},
+		{"0.0.0.0/0", []Match{
+			{"bad", netip.MustParsePrefix("1.1.1.0/24")},
+			{"tor", netip.MustParsePrefix("1.1.1.1/32")},
+			{"tor", netip.MustParsePrefix("8.8.8.8/32")},
+		}},
+		{"9.9.9.0/24", []Match{}},
+	} {
+		if got := s.Matches(netip.MustParsePrefix(tt.prefix)); !slices.Equal(got, tt.want) {
+			t.Errorf("Matches(%s) = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	s := testSet(t)
+
+	for _, tt := range []struct {
+		names []string
+		want  []netip.Prefix
+	}{
+		{nil, mustPrefixes("1.1.1.0/24", "8.8.8.8/32", "2606:4700::/32")},
+		{[]string{"tor"}, mustPrefixes("1.1.1.1/32", "8.8.8.8/32")},
+		{[]string{"bad"}, mustPrefixes("1.1.1.0/24", "2606:4700::/32")},
+		{[]string{"missing"}, []netip.Prefix{}},
+	} {
+		if got := s.Prefixes(tt.names...); !slices.Equal(got, tt.want) {
+			t.Errorf("Prefixes(%v) = %v, want %v", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"googlebot.txt": "66.249.64.0/19\n",
+		"tor.txt":       "1.1.1.1\n",
+		"notes.md":      "8.8.8.8\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Names(); !slices.Equal(got, []string{"googlebot", "tor"}) {
+		t.Errorf("Names() = %v, want [googlebot tor]", got)
+	}
+	if got := s.Lookup(netip.MustParseAddr("66.249.66.1")); !slices.Equal(got, []string{"googlebot"}) {
+		t.Errorf("Lookup() = %v, want [googlebot]", got)
+	}
+	if s.Contains(netip.MustParseAddr("8.8.8.8")) {
+		t.Error("LoadDir() loaded a file which is not a list")
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("Load() of a missing file returned no error")
+	}
+	if s, err := LoadDir(filepath.Join(dir, "missing")); err != nil || len(s.Names()) != 0 {
+		t.Errorf("LoadDir() of a missing directory = %v %v, want an empty Set", s.Names(), err)
+	}
+}
+
+func TestName(t *testing.T) {
+	for file, want := range map[string]string{
+		"lists/googlebot.txt": "googlebot",
+		"tor.txt":             "tor",
+		"/tmp/a.b.txt":        "a.b",
+		"bad":                 "bad",
+	} {
+		if got := Name(file); got != want {
+			t.Errorf("Name(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
+
+func mustPrefixes(entries ...string) []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	for _, entry := range entries {
+		prefixes = append(prefixes, netip.MustParsePrefix(entry))
+	}
+
+	return prefixes
+}
@@ -0,0 +1,190 @@
+// Package middleware provides net/http middleware which blocks, allows or tags
+// requests by whether the client IP is in one or more lists.
+package middleware
+
+import (
+	"context"
+	"errors"
+	"iplists/pkg/lists"
+	"iplists/pkg/realip"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// Policy is the action taken for a request depending on its list membership.
+type Policy int
+
+const (
+	// Block rejects requests from clients in any of the lists, and requests
+	// whose client IP can't be determined, eg: a malformed forwarded header.
+	Block Policy = iota
+	// AllowOnly rejects requests from clients in none of the lists, and
+	// requests whose client IP can't be determined.
+	AllowOnly
+	// Tag passes every request on, setting the header to the matching lists.
+	Tag
+	// Log passes every request on, logging those from clients in the lists.
+	Log
+)
+
+// DefaultHeader is the request header set by the Tag policy.
+const DefaultHeader = "X-IP-Lists"
+
+// Config configures the middleware.
+type Config struct {
+	// Files are the list files to match client IPs against.
+	Files []string
+	// Policy is the action taken for matching (or non-matching) requests.
+	Policy Policy
+	// Header is the request header set by the Tag policy, DefaultHeader if empty.
+	Header string
+	// Status is the response status of rejected requests, 403 if zero.
+	Status int
+	// Logger logs matching requests for the Log policy, slog.Default if nil.
+	Logger *slog.Logger
+	// ClientIP returns the client IP of a request. If nil, the client IP is
+	// resolved through TrustedProxies, or is the RemoteAddr if there are none.
+	ClientIP func(r *http.Request) (netip.Addr, error)
+	// TrustedProxies are list files of proxies whose forwarded headers are
+	// trusted, eg: "lists/cloudflare.txt".
+	TrustedProxies []string
+	// ProxyHeaders are the forwarded headers of trusted proxies, see realip.New.
+	ProxyHeaders []string
+}
+
+// Middleware evaluates client IPs against a set of lists which can be reloaded
+// at any time without blocking requests.
+type Middleware struct {
+	config   Config
+	set      atomic.Pointer[lists.Set]
+	resolver atomic.Pointer[realip.Resolver]
+}
+
+type contextKey struct{}
+
+// New returns a Middleware, loading the configured list files.
+func New(config Config) (*Middleware, error) {
+	if config.Header == "" {
+		config.Header = DefaultHeader
+	}
+	if config.Status == 0 {
+		config.Status = http.StatusForbidden
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	m := &Middleware{config: config}
+	if m.config.ClientIP == nil {
+		m.config.ClientIP = RemoteAddr
+		if len(config.TrustedProxies) > 0 {
+			m.config.ClientIP = func(r *http.Request) (netip.Addr, error) {
+				return m.resolver.Load().ClientIP(r)
+			}
+		}
+	}
+
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Reload loads the list files again, atomically replacing the current lists
+// and trusted proxies. The current lists are kept if any file cannot be read.
+func (m *Middleware) Reload() error {
+	set, err := lists.Load(m.config.Files...)
+	if err != nil {
+		return err
+	}
+
+	if len(m.config.TrustedProxies) > 0 {
+		trusted, err := realip.LoadTrusted(m.config.TrustedProxies...)
+		if err != nil {
+			return err
+		}
+		m.resolver.Store(realip.New(trusted, m.config.ProxyHeaders...))
+	}
+
+	m.Store(set)
+
+	return nil
+}
+
+// Store atomically replaces the current lists.
+func (m *Middleware) Store(set *lists.Set) {
+	m.set.Store(set)
+}
+
+// Lists returns the current lists.
+func (m *Middleware) Lists() *lists.Set {
+	return m.set.Load()
+}
+
+// Handler wraps a handler, applying the policy to every request. The names of
+// the matching lists are available to the next handler with FromContext. When
+// the client IP can't be determined the Block & AllowOnly policies fail closed,
+// while Tag & Log pass the request on unmatched.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := m.config.ClientIP(r)
+		names := []string{}
+		if err == nil {
+			names = m.set.Load().Lookup(addr)
+		}
+
+		switch m.config.Policy {
+		case Block:
+			// falling back to the peer address would let a client spoofing a
+			// malformed header through, so an unknown client IP is rejected
+			if err != nil || len(names) > 0 {
+				http.Error(w, http.StatusText(m.config.Status), m.config.Status)
+				return
+			}
+		case AllowOnly:
+			// an unknown client IP is never allowed
+			if len(names) == 0 {
+				http.Error(w, http.StatusText(m.config.Status), m.config.Status)
+				return
+			}
+		case Tag:
+			// never trust a header supplied by the client
+			r.Header.Del(m.config.Header)
+			if len(names) > 0 {
+				r.Header.Set(m.config.Header, strings.Join(names, ","))
+			}
+		case Log:
+			if len(names) > 0 {
+				m.config.Logger.Info("request from listed IP",
+					"ip", addr.String(),
+					"lists", names,
+					"method", r.Method,
+					"path", r.URL.Path,
+				)
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, names)))
+	})
+}
+
+// FromContext returns the names of the lists containing the client IP, as set
+// by the middleware.
+func FromContext(ctx context.Context) []string {
+	names, _ := ctx.Value(contextKey{}).([]string)
+	return names
+}
+
+// RemoteAddr returns the IP of the directly connected peer.
+func RemoteAddr(r *http.Request) (netip.Addr, error) {
+	addr, err := realip.ParseHost(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, errors.New("invalid remote address: " + r.RemoteAddr)
+	}
+
+	return addr, nil
+}
@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeList writes a list file of the entries to dir, returning its path.
+func writeList(t *testing.T, dir, name string, entries ...string) string {
+	t.Helper()
+
+	file := filepath.Join(dir, name+".txt")
+	if err := os.WriteFile(file, []byte(strings.Join(entries, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// request sends a request from a remote address through the middleware,
+// returning the response and the request received by the next handler, nil if
+// it was rejected.
+func request(m *Middleware, remoteAddr string, header http.Header) (*httptest.ResponseRecorder, *http.Request) {
+	var received *http.Request
+	handler := m.Handler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/path", nil)
+	r.RemoteAddr = remoteAddr
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w, received
+}
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{
+		writeList(t, dir, "bad", "1.1.1.0/24", "2606:4700::/32"),
+		writeList(t, dir, "tor", "1.1.1.1"),
+	}
+	trusted := writeList(t, dir, "proxies", "10.0.0.0/8")
+
+	for _, tt := range []struct {
+		name       string
+		config     Config
+		remoteAddr string
+		header     http.Header
+		wantStatus int
+		// wantLists are the lists passed on in the context, nil if rejected
+		wantLists []string
+		wantTag   string
+	}{
+		{"block listed", Config{Policy: Block}, "1.1.1.1:1234", nil, 403, nil, ""},
+		{"block listed IPv6", Config{Policy: Block}, "[2606:4700::1]:443", nil, 403, nil, ""},
+		{"block listed IPv4-mapped", Config{Policy: Block}, "[::ffff:1.1.1.2]:443", nil, 403, nil, ""},
+		{"block unlisted", Config{Policy: Block}, "8.8.8.8:1234", nil, 200, []string{}, ""},
+		{"block status", Config{Policy: Block, Status: http.StatusTeapot}, "1.1.1.1:1234", nil, http.StatusTeapot, nil, ""},
+		{"block unknown client", Config{Policy: Block}, "invalid", nil, 403, nil, ""},
+		{"block forwarded", Config{Policy: Block, TrustedProxies: []string{trusted}}, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"1.1.1.1"}}, 403, nil, ""},
+		{"block untrusted forwarded", Config{Policy: Block, TrustedProxies: []string{trusted}}, "8.8.8.8:1234",
+			http.Header{"X-Forwarded-For": {"1.1.1.1"}}, 200, []string{}, ""},
+		{"block malformed forwarded", Config{Policy: Block, TrustedProxies: []string{trusted}}, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"8.8.8.8, not-an-ip"}}, 403, nil, ""},
+		{"allow only listed", Config{Policy: AllowOnly}, "1.1.1.1:1234", nil, 200, []string{"bad", "tor"}, ""},
+		{"allow only unlisted", Config{Policy: AllowOnly}, "8.8.8.8:1234", nil, 403, nil, ""},
+		{"allow only unknown client", Config{Policy: AllowOnly}, "invalid", nil, 403, nil, ""},
+		{"allow only malformed forwarded", Config{Policy: AllowOnly, TrustedProxies: []string{trusted}}, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"1.1.1.1, not-an-ip"}}, 403, nil, ""},
+		{"tag listed", Config{Policy: Tag}, "1.1.1.1:1234",
+			http.Header{"X-Ip-Lists": {"spoofed"}}, 200, []string{"bad", "tor"}, "bad,tor"},
+		{"tag unlisted removes header", Config{Policy: Tag}, "8.8.8.8:1234",
+			http.Header{"X-Ip-Lists": {"spoofed"}}, 200, []string{}, ""},
+		{"tag header", Config{Policy: Tag, Header: "X-Listed"}, "1.1.1.3:1234",
+			http.Header{"X-Listed": {"spoofed"}}, 200, []string{"bad"}, "bad"},
+		{"tag unknown client", Config{Policy: Tag}, "invalid",
+			http.Header{"X-Ip-Lists": {"spoofed"}}, 200, []string{}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Files = files
+			m, err := New(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w, received := request(m, tt.remoteAddr, tt.header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantLists == nil {
+				if received != nil {
+					t.Fatal("rejected request passed on")
+				}
+				return
+			}
+
+			if got := FromContext(received.Context()); !slices.Equal(got, tt.wantLists) {
+				t.Errorf("FromContext() = %v, want %v", got, tt.wantLists)
+			}
+			if tt.config.Policy == Tag {
+				header := tt.config.Header
+				if header == "" {
+					header = DefaultHeader
+				}
+				if got := received.Header.Values(header); strings.Join(got, ",") != tt.wantTag {
+					t.Errorf("%s = %v, want %q", header, got, tt.wantTag)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerLog(t *testing.T) {
+	file := writeList(t, t.TempDir(), "bad", "1.1.1.0/24")
+	var logs bytes.Buffer
+	m, err := New(Config{Files: []string{file}, Policy: Log, Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w, received := request(m, "1.1.1.1:1234", nil); w.Code != 200 || received == nil {
+		t.Fatalf("listed request status = %d, want passed on", w.Code)
+	}
+	if w, received := request(m, "8.8.8.8:1234", nil); w.Code != 200 || received == nil {
+		t.Fatalf("unlisted request status = %d, want passed on", w.Code)
+	}
+
+	if got := strings.Count(logs.String(), "request from listed IP"); got != 1 {
+		t.Fatalf("logged %d requests, want 1: %s", got, logs.String())
+	}
+	if !strings.Contains(logs.String(), "ip=1.1.1.1") || !strings.Contains(logs.String(), "path=/path") {
+		t.Errorf("log = %s, want the IP & path", logs.String())
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	file := writeList(t, dir, "bad", "1.1.1.1")
+	m, err := New(Config{Files: []string{file}, Policy: Block})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a request in flight keeps the lists it was evaluated against
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	var inFlightLists []string
+	handler := m.Handler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.RemoteAddr == "8.8.8.8:1234" {
+			close(inFlight)
+			<-release
+			inFlightLists = FromContext(r.Context())
+		}
+	}))
+
+	done := make(chan int)
+	go func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "8.8.8.8:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		done <- w.Code
+	}()
+	<-inFlight
+
+	// concurrent requests see either the old or the new lists
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 4 {
+		wg.Go(func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if w, _ := request(m, "1.1.1.1:1234", nil); w.Code != 200 && w.Code != 403 {
+					t.Errorf("status = %d during reload", w.Code)
+					return
+				}
+			}
+		})
+	}
+
+	writeList(t, dir, "bad", "8.8.8.8")
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+	wg.Wait()
+
+	close(release)
+	if code := <-done; code != 200 || len(inFlightLists) != 0 {
+		t.Errorf("in flight request = %d %v, want 200 evaluated against the previous lists", code, inFlightLists)
+	}
+
+	if w, _ := request(m, "8.8.8.8:1234", nil); w.Code != 403 {
+		t.Errorf("newly listed status = %d, want 403", w.Code)
+	}
+	if w, _ := request(m, "1.1.1.1:1234", nil); w.Code != 200 {
+		t.Errorf("no longer listed status = %d, want 200", w.Code)
+	}
+
+	// a failed reload keeps the current lists
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(); err == nil {
+		t.Fatal("Reload() of a missing file returned no error")
+	}
+	if w, _ := request(m, "8.8.8.8:1234", nil); w.Code != 403 {
+		t.Errorf("status after a failed reload = %d, want 403", w.Code)
+	}
+}
+
+func TestRemoteAddr(t *testing.T) {
+	for _, tt := range []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"1.1.1.1:1234", "1.1.1.1"},
+		{"[2606:4700::1]:443", "2606:4700::1"},
+		{"[::ffff:1.1.1.1]:443", "1.1.1.1"},
+		{"1.1.1.1", "1.1.1.1"},
+		{"invalid:1234", ""},
+		{"", ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		addr, err := RemoteAddr(r)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("RemoteAddr(%q) = %s, want an error", tt.remoteAddr, addr)
+			}
+			continue
+		}
+		if err != nil || addr.String() != tt.want {
+			t.Errorf("RemoteAddr(%q) = %s %v, want %s", tt.remoteAddr, addr, err, tt.want)
+		}
+	}
+}
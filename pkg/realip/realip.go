@@ -0,0 +1,143 @@
+// Package realip resolves the real client IP of a request behind trusted
+// proxies, such as Cloudflare, using the lists to decide which hops to trust.
+package realip
+
+import (
+	"errors"
+	"fmt"
+	"iplists/pkg/lists"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// XForwardedFor is the de-facto standard header of proxy hops, each proxy
+// appending the address it received the request from.
+const XForwardedFor = "X-Forwarded-For"
+
+// CFConnectingIP is the header Cloudflare sets to the client IP.
+const CFConnectingIP = "CF-Connecting-IP"
+
+// ErrInvalidHop is returned when a forwarded header contains an invalid IP.
+var ErrInvalidHop = errors.New("invalid forwarded IP")
+
+// Resolver resolves client IPs, trusting forwarded headers only from proxies
+// in the trusted lists.
+type Resolver struct {
+	trusted *lists.Set
+	headers []string
+}
+
+// New returns a Resolver trusting the proxies in the lists. Headers are checked
+// in order when the peer is trusted, defaulting to X-Forwarded-For. Any header
+// other than X-Forwarded-For (eg: CF-Connecting-IP) must hold a single IP set
+// by the trusted peer itself.
+func New(trusted *lists.Set, headers ...string) *Resolver {
+	if len(headers) == 0 {
+		headers = []string{XForwardedFor}
+	}
+
+	return &Resolver{trusted: trusted, headers: headers}
+}
+
+// LoadTrusted returns the trusted proxies from list files, keeping reserved
+// (private, loopback etc) entries for internal proxies.
+func LoadTrusted(files ...string) (*lists.Set, error) {
+	trusted := lists.New()
+	trusted.Reserved = true
+	for _, file := range files {
+		if err := trusted.AddFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return trusted, nil
+}
+
+// Trusted returns whether an address is a trusted proxy.
+func (r *Resolver) Trusted(addr netip.Addr) bool {
+	return r.trusted.Contains(addr)
+}
+
+// ClientIP returns the real client IP of a request. The peer address is used
+// unless it is a trusted proxy, in which case X-Forwarded-For is walked from
+// right to left, skipping trusted hops, until the first untrusted hop (the
+// client). If every hop is trusted the leftmost is returned.
+func (r *Resolver) ClientIP(req *http.Request) (netip.Addr, error) {
+	peer, err := ParseHost(req.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	if !r.Trusted(peer) {
+		return peer, nil
+	}
+
+	for _, header := range r.headers {
+		values := req.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+
+		if !strings.EqualFold(header, XForwardedFor) {
+			addr, err := ParseHost(strings.TrimSpace(values[len(values)-1]))
+			if err != nil {
+				return netip.Addr{}, fmt.Errorf("%w in %s: %w", ErrInvalidHop, header, err)
+			}
+			return addr, nil
+		}
+
+		return r.walk(peer, hops(values))
+	}
+
+	return peer, nil
+}
+
+// walk returns the rightmost untrusted hop, or the leftmost if all are trusted.
+func (r *Resolver) walk(peer netip.Addr, hops []string) (netip.Addr, error) {
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := ParseHost(hops[i])
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("%w in %s: %w", ErrInvalidHop, XForwardedFor, err)
+		}
+
+		client = addr
+		if !r.Trusted(addr) {
+			break
+		}
+	}
+
+	return client, nil
+}
+
+// hops splits the values of a header, which may be repeated, into its hops.
+func hops(values []string) []string {
+	hops := []string{}
+	for _, value := range values {
+		for hop := range strings.SplitSeq(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	return hops
+}
+
+// ParseHost parses an IP which may include a port, eg: "[::1]:443", returning
+// IPv4-mapped IPv6 addresses as IPv4.
+func ParseHost(s string) (netip.Addr, error) {
+	host := s
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		host = h
+	}
+
+	addr, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	return addr.Unmap().WithZone(""), nil
+}
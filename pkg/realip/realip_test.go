@@ -0,0 +1,164 @@
+package realip
+
+import (
+	"errors"
+	"iplists/pkg/lists"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func trustedSet() *lists.Set {
+	trusted := lists.New()
+	trusted.Reserved = true
+	for _, p := range []string{"10.0.0.0/8", "173.245.48.0/20", "2400:cb00::/32"} {
+		trusted.AddPrefix("proxies", netip.MustParsePrefix(p))
+	}
+
+	return trusted
+}
+
+// errAny is a wanted error of any kind.
+var errAny = errors.New("any error")
+
+func TestClientIP(t *testing.T) {
+	xff := New(trustedSet())
+	cf := New(trustedSet(), CFConnectingIP)
+	cfThenXFF := New(trustedSet(), CFConnectingIP, XForwardedFor)
+
+	for _, tt := range []struct {
+		name       string
+		resolver   *Resolver
+		remoteAddr string
+		header     http.Header
+		want       string
+		// wantErr is ErrInvalidHop for a malformed hop, or errAny
+		wantErr error
+	}{
+		{"untrusted peer ignores forwarded", xff, "1.1.1.1:1234",
+			http.Header{"X-Forwarded-For": {"8.8.8.8"}}, "1.1.1.1", nil},
+		{"untrusted peer ignores malformed forwarded", xff, "1.1.1.1:1234",
+			http.Header{"X-Forwarded-For": {"bogus"}}, "1.1.1.1", nil},
+		{"trusted peer without header", xff, "10.0.0.1:1234", nil, "10.0.0.1", nil},
+		{"single hop", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"1.1.1.1"}}, "1.1.1.1", nil},
+		{"rightmost untrusted hop", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"8.8.8.8, 1.1.1.1, 10.0.0.2"}}, "1.1.1.1", nil},
+		{"all hops trusted", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"10.0.0.3, 173.245.48.1, 10.0.0.2"}}, "10.0.0.3", nil},
+		{"malformed hop", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"1.1.1.1, bogus"}}, "", ErrInvalidHop},
+		{"malformed hop behind a trusted hop", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"1.1.1.1, 10.0.0.300, 10.0.0.2"}}, "", ErrInvalidHop},
+		{"malformed hop left of the client", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"bogus, 1.1.1.1"}}, "1.1.1.1", nil},
+		{"multiple headers", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"8.8.8.8, 1.1.1.1", "10.0.0.2, 10.0.0.3"}}, "1.1.1.1", nil},
+		{"multiple headers, client in the last", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"8.8.8.8", "1.1.1.1"}}, "1.1.1.1", nil},
+		{"empty hops", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"1.1.1.1,, ", ""}}, "1.1.1.1", nil},
+		{"hops with ports", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"[2606:4700::1]:443, 10.0.0.2:80"}}, "2606:4700::1", nil},
+		{"IPv6 trusted peer", xff, "[2400:cb00::1]:443",
+			http.Header{"X-Forwarded-For": {"2606:4700::1"}}, "2606:4700::1", nil},
+		{"IPv4-mapped trusted peer", xff, "[::ffff:10.0.0.1]:443",
+			http.Header{"X-Forwarded-For": {"1.1.1.1"}}, "1.1.1.1", nil},
+		{"IPv4-mapped untrusted peer", xff, "[::ffff:1.1.1.1]:443",
+			http.Header{"X-Forwarded-For": {"8.8.8.8"}}, "1.1.1.1", nil},
+		{"IPv4-mapped hops", xff, "10.0.0.1:1234",
+			http.Header{"X-Forwarded-For": {"::ffff:1.1.1.1, ::ffff:10.0.0.2"}}, "1.1.1.1", nil},
+		{"zoned peer", xff, "[fe80::1%eth0]:443", nil, "fe80::1", nil},
+		{"invalid peer", xff, "bogus:1234", nil, "", errAny},
+		{"CF-Connecting-IP from trusted peer", cf, "173.245.48.1:443",
+			http.Header{"Cf-Connecting-Ip": {"1.1.1.1"}, "X-Forwarded-For": {"8.8.8.8"}}, "1.1.1.1", nil},
+		{"CF-Connecting-IP from untrusted peer", cf, "8.8.4.4:443",
+			http.Header{"Cf-Connecting-Ip": {"1.1.1.1"}}, "8.8.4.4", nil},
+		{"CF-Connecting-IP malformed", cf, "173.245.48.1:443",
+			http.Header{"Cf-Connecting-Ip": {"1.1.1.1, 8.8.8.8"}}, "", ErrInvalidHop},
+		{"CF-Connecting-IP missing", cf, "173.245.48.1:443",
+			http.Header{"X-Forwarded-For": {"8.8.8.8"}}, "173.245.48.1", nil},
+		{"CF-Connecting-IP missing falls back", cfThenXFF, "173.245.48.1:443",
+			http.Header{"X-Forwarded-For": {"8.8.8.8"}}, "8.8.8.8", nil},
+		{"CF-Connecting-IP before X-Forwarded-For", cfThenXFF, "173.245.48.1:443",
+			http.Header{"Cf-Connecting-Ip": {"1.1.1.1"}, "X-Forwarded-For": {"8.8.8.8"}}, "1.1.1.1", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+
+			got, err := tt.resolver.ClientIP(r)
+			switch {
+			case tt.wantErr == errAny:
+				if err == nil {
+					t.Fatalf("ClientIP() = %s, want an error", got)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ClientIP() = %s %v, want %v", got, err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case got != netip.MustParseAddr(tt.want):
+				t.Fatalf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHost(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want string
+	}{
+		{"1.1.1.1", "1.1.1.1"},
+		{"1.1.1.1:80", "1.1.1.1"},
+		{"2606:4700::1", "2606:4700::1"},
+		{"[2606:4700::1]", "2606:4700::1"},
+		{"[2606:4700::1]:443", "2606:4700::1"},
+		{"::ffff:1.1.1.1", "1.1.1.1"},
+		{"[fe80::1%eth0]:443", "fe80::1"},
+		{"", ""},
+		{"bogus", ""},
+		{"1.1.1.1, 8.8.8.8", ""},
+	} {
+		got, err := ParseHost(tt.s)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseHost(%q) = %s, want an error", tt.s, got)
+			}
+			continue
+		}
+		if err != nil || got != netip.MustParseAddr(tt.want) {
+			t.Errorf("ParseHost(%q) = %s %v, want %s", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadTrusted(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "proxies.txt")
+	if err := os.WriteFile(file, []byte("10.0.0.0/8\n127.0.0.1\n173.245.48.0/20\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	trusted, err := LoadTrusted(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := New(trusted)
+	for addr, want := range map[string]bool{"10.1.2.3": true, "127.0.0.1": true, "173.245.48.1": true, "1.1.1.1": false} {
+		if got := resolver.Trusted(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Trusted(%s) = %v, want %v", addr, got, want)
+		}
+	}
+
+	if _, err := LoadTrusted(file + ".missing"); err == nil {
+		t.Error("LoadTrusted() of a missing file returned no error")
+	}
+}